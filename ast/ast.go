@@ -2,7 +2,6 @@ package ast
 
 import (
 	"bytes"
-	"fmt"
 	"strings"
 
 	"github.com/Revolyssup/monkey/token"
@@ -11,7 +10,8 @@ import (
 //Everything is a node in AST and has to implement a TokenLiteral method
 type Node interface {
 	TokenLiteral() string
-	String() string // Return the exact string of code. Useful for debugging
+	String() string   // Return the exact string of code. Useful for debugging
+	Span() token.Span // Where in the source this node was parsed from
 }
 
 //There are two types of node. Expression and Statement.
@@ -41,6 +41,13 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Span() token.Span {
+	if len(p.Statements) == 0 {
+		return token.Span{}
+	}
+	return token.Span{Start: p.Statements[0].Span().Start, End: p.Statements[len(p.Statements)-1].Span().End}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -65,6 +72,9 @@ func (i *Identifier) TokenLiteral() string {
 func (i *Identifier) String() string {
 	return i.Value
 }
+func (i *Identifier) Span() token.Span {
+	return i.Token.Span()
+}
 
 /***Integer Literal*/
 type IntegerLiteral struct {
@@ -79,6 +89,26 @@ func (i *IntegerLiteral) TokenLiteral() string {
 func (i *IntegerLiteral) String() string {
 	return i.Token.Literal
 }
+func (i *IntegerLiteral) Span() token.Span {
+	return i.Token.Span()
+}
+
+/***Float Literal*/
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) expNode() {}
+func (f *FloatLiteral) TokenLiteral() string {
+	return f.Token.Literal
+}
+func (f *FloatLiteral) String() string {
+	return f.Token.Literal
+}
+func (f *FloatLiteral) Span() token.Span {
+	return f.Token.Span()
+}
 
 //String
 type StringLiteral struct {
@@ -93,22 +123,61 @@ func (s *StringLiteral) TokenLiteral() string {
 func (s *StringLiteral) String() string {
 	return s.Token.Literal
 }
+func (s *StringLiteral) Span() token.Span {
+	return s.Token.Span()
+}
 
-//Object- key-value pairs
+//"text ${expr} text"- the pieces of text around the expressions. There is always one more of Texts than of Values,
+//so Texts[i] comes before Values[i] and the last text ends the string.
+type InterpolatedString struct {
+	Token  token.Token //the head, up to the first ${
+	Texts  []string
+	Values []Expression
+	End    token.Position //end of the closing "
+}
+
+func (s *InterpolatedString) expNode() {}
+func (s *InterpolatedString) TokenLiteral() string {
+	return s.Token.Literal
+}
+func (s *InterpolatedString) Span() token.Span {
+	return token.Span{Start: s.Token.Pos, End: s.End}
+}
+func (s *InterpolatedString) String() string {
+	var out bytes.Buffer
+	for i, text := range s.Texts {
+		out.WriteString(text)
+		if i < len(s.Values) {
+			out.WriteString("${" + s.Values[i].String() + "}")
+		}
+	}
+	return out.String()
+}
+
+//Object- key-value pairs, in the order they were written.
 type ObjectLiteral struct {
 	Token token.Token
-	Value map[Expression]Expression
+	Pairs []ObjectPair
+	End   token.Position //end of the closing }}
+}
+
+type ObjectPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (obj *ObjectLiteral) expNode() {}
 func (obj *ObjectLiteral) TokenLiteral() string {
 	return obj.Token.Literal
 }
+func (obj *ObjectLiteral) Span() token.Span {
+	return token.Span{Start: obj.Token.Pos, End: obj.End}
+}
 func (obj *ObjectLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("{")
-	for key, value := range obj.Value {
-		out.WriteString(key.String() + ":" + value.String() + ",\n")
+	for _, pair := range obj.Pairs {
+		out.WriteString(pair.Key.String() + ":" + pair.Value.String() + ",\n")
 	}
 	out.WriteString("}")
 	return out.String()
@@ -118,6 +187,7 @@ func (obj *ObjectLiteral) String() string {
 type ArrayLiteral struct {
 	Token token.Token
 	Value []Expression
+	End   token.Position //end of the closing ]
 }
 
 func (arr *ArrayLiteral) expNode() {}
@@ -125,6 +195,10 @@ func (arr *ArrayLiteral) TokenLiteral() string {
 	return arr.Token.Literal
 }
 
+func (arr *ArrayLiteral) Span() token.Span {
+	return token.Span{Start: arr.Token.Pos, End: arr.End}
+}
+
 func (arr *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("[")
@@ -147,6 +221,9 @@ func (b *Boolean) expNode() {}
 func (i *Boolean) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (b *Boolean) Span() token.Span {
+	return b.Token.Span()
+}
 func (b *Boolean) String() string {
 	var out bytes.Buffer
 	out.WriteString(b.TokenLiteral())
@@ -168,6 +245,16 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Span() token.Span {
+	span := ls.Token.Span()
+	if ls.Value != nil {
+		span.End = ls.Value.Span().End
+	} else if ls.Name != nil {
+		span.End = ls.Name.Span().End
+	}
+	return span
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -193,6 +280,14 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Span() token.Span {
+	span := rs.Token.Span()
+	if rs.ReturnValue != nil {
+		span.End = rs.ReturnValue.Span().End
+	}
+	return span
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -204,6 +299,38 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+/*****BREAK AND CONTINUE*******/
+
+type BreakStatement struct {
+	Token token.Token //BREAK token
+}
+
+func (bs *BreakStatement) stateNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) Span() token.Span {
+	return bs.Token.Span()
+}
+func (bs *BreakStatement) String() string {
+	return bs.TokenLiteral() + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token //CONTINUE token
+}
+
+func (cs *ContinueStatement) stateNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) Span() token.Span {
+	return cs.Token.Span()
+}
+func (cs *ContinueStatement) String() string {
+	return cs.TokenLiteral() + ";"
+}
+
 /*************Expression Statement*******/
 
 type ExpressionStatement struct {
@@ -215,6 +342,12 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 func (es *ExpressionStatement) stateNode() {}
+func (es *ExpressionStatement) Span() token.Span {
+	if es.Expression == nil {
+		return es.Token.Span()
+	}
+	return es.Expression.Span()
+}
 func (es *ExpressionStatement) String() string {
 	return es.Expression.String()
 }
@@ -231,6 +364,13 @@ func (pe *PrefixExpression) TokenLiteral() string {
 }
 
 func (pe *PrefixExpression) expNode() {}
+func (pe *PrefixExpression) Span() token.Span {
+	span := pe.Token.Span()
+	if pe.RightExpression != nil {
+		span.End = pe.RightExpression.Span().End
+	}
+	return span
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -254,6 +394,17 @@ func (pe *InfixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (ie *InfixExpression) Span() token.Span {
+	span := ie.Token.Span()
+	if ie.LeftExpression != nil {
+		span.Start = ie.LeftExpression.Span().Start
+	}
+	if ie.RightExpression != nil {
+		span.End = ie.RightExpression.Span().End
+	}
+	return span
+}
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -265,10 +416,60 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+//POSTFIX x++ and x--
+type PostfixExpression struct {
+	Token          token.Token //the operator
+	LeftExpression Expression
+	Operator       string
+}
+
+func (pe *PostfixExpression) expNode() {}
+func (pe *PostfixExpression) TokenLiteral() string {
+	return pe.Token.Literal
+}
+func (pe *PostfixExpression) Span() token.Span {
+	span := pe.Token.Span()
+	if pe.LeftExpression != nil {
+		span.Start = pe.LeftExpression.Span().Start
+	}
+	return span
+}
+func (pe *PostfixExpression) String() string {
+	return "(" + pe.LeftExpression.String() + pe.Operator + ")"
+}
+
+//Assignment to an existing variable: x = 5, or one of the compound forms like x += 5.
+//Unlike let, it is an expression and evaluates to the assigned value, so a = b = 0 works.
+type AssignExpression struct {
+	Token    token.Token //the operator
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) Span() token.Span {
+	span := ae.Token.Span()
+	if ae.Target != nil {
+		span.Start = ae.Target.Span().Start
+	}
+	if ae.Value != nil {
+		span.End = ae.Value.Span().End
+	}
+	return span
+}
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Target.String() + " " + ae.Operator + " " + ae.Value.String() + ")"
+}
+
 //Block expressions are slice of statements ,nested under { []statements }
 type BlockStatement struct {
 	Token token.Token
 	Stmts []Statement
+	End   token.Position //end of the closing }
 }
 
 func (bs *BlockStatement) stateNode() {}
@@ -276,6 +477,10 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+func (bs *BlockStatement) Span() token.Span {
+	return token.Span{Start: bs.Token.Pos, End: bs.End}
+}
+
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, stmt := range bs.Stmts {
@@ -297,6 +502,16 @@ func (ife *IfExpression) TokenLiteral() string {
 	return ife.Token.Literal
 }
 
+func (ife *IfExpression) Span() token.Span {
+	span := ife.Token.Span()
+	if ife.AltStmt != nil {
+		span.End = ife.AltStmt.End
+	} else if ife.MainStmt != nil {
+		span.End = ife.MainStmt.End
+	}
+	return span
+}
+
 func (ife *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -312,10 +527,71 @@ func (ife *IfExpression) String() string {
 	return out.String()
 }
 
-//For expression
+//Match expression- match (value) { pattern => expr, pattern if guard => { block }, ... }
+//The first arm whose pattern matches, and whose guard if any is truthy, gives the value of the whole expression.
+type MatchExpression struct {
+	Token token.Token //match
+	Value Expression
+	Arms  []*MatchArm
+	End   token.Position //end of the closing }
+}
+
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression //nil when the arm has no if
+	Body    *BlockStatement
+}
+
+func (me *MatchExpression) expNode() {}
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+func (me *MatchExpression) Span() token.Span {
+	return token.Span{Start: me.Token.Pos, End: me.End}
+}
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("match (" + me.Value.String() + ") {")
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (arm *MatchArm) String() string {
+	s := arm.Pattern.String()
+	if arm.Guard != nil {
+		s += " if " + arm.Guard.String()
+	}
+	return s + " => " + arm.Body.String()
+}
+
+//The _ pattern of match, which matches anything.
+type Wildcard struct {
+	Token token.Token
+}
+
+func (w *Wildcard) expNode() {}
+func (w *Wildcard) TokenLiteral() string {
+	return w.Token.Literal
+}
+func (w *Wildcard) Span() token.Span {
+	return w.Token.Span()
+}
+func (w *Wildcard) String() string {
+	return "_"
+}
+
+//For expression. for (cond) { } loops while cond is truthy, and for (init; cond; update) { } is the C style loop.
+//Init and Update are nil in the first form, and any of the three parts can be left out in the second.
 type ForExpression struct {
 	Token     token.Token
+	Init      Statement
 	Condition Expression
+	Update    Expression
 	Stmt      *BlockStatement
 }
 
@@ -323,15 +599,68 @@ func (fe *ForExpression) expNode() {}
 func (fe *ForExpression) TokenLiteral() string {
 	return fe.Token.Literal
 }
+func (fe *ForExpression) Span() token.Span {
+	span := fe.Token.Span()
+	if fe.Stmt != nil {
+		span.End = fe.Stmt.End
+	}
+	return span
+}
 func (fe *ForExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("for ")
-	out.WriteString(fe.Condition.String())
+	if fe.Init != nil || fe.Update != nil {
+		out.WriteString("(")
+		if fe.Init != nil {
+			out.WriteString(strings.TrimSuffix(fe.Init.String(), ";"))
+		}
+		out.WriteString("; ")
+		if fe.Condition != nil {
+			out.WriteString(fe.Condition.String())
+		}
+		out.WriteString("; ")
+		if fe.Update != nil {
+			out.WriteString(fe.Update.String())
+		}
+		out.WriteString(")")
+	} else if fe.Condition != nil {
+		out.WriteString(fe.Condition.String())
+	}
 	out.WriteString(" ")
 	out.WriteString(fe.Stmt.String())
 	return out.String()
 }
 
+//For-in expression- for (x in iterable) { } and for (k, v in iterable) { }
+type ForInExpression struct {
+	Token    token.Token
+	Vars     []*Identifier //one or two
+	Iterable Expression
+	Stmt     *BlockStatement
+}
+
+func (fe *ForInExpression) expNode() {}
+func (fe *ForInExpression) TokenLiteral() string {
+	return fe.Token.Literal
+}
+func (fe *ForInExpression) Span() token.Span {
+	span := fe.Token.Span()
+	if fe.Stmt != nil {
+		span.End = fe.Stmt.End
+	}
+	return span
+}
+func (fe *ForInExpression) String() string {
+	var out bytes.Buffer
+	vars := []string{}
+	for _, v := range fe.Vars {
+		vars = append(vars, v.String())
+	}
+	out.WriteString("for (" + strings.Join(vars, ", ") + " in " + fe.Iterable.String() + ") ")
+	out.WriteString(fe.Stmt.String())
+	return out.String()
+}
+
 //Function Literalss fn(params){body}
 type FunctionLiteral struct {
 	Token  token.Token //fn
@@ -344,6 +673,14 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Span() token.Span {
+	span := fl.Token.Span()
+	if fl.Body != nil {
+		span.End = fl.Body.End
+	}
+	return span
+}
+
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("fn")
@@ -366,6 +703,7 @@ type FunctionCall struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	End       token.Position //end of the closing )
 }
 
 func (fc *FunctionCall) expNode() {}
@@ -373,6 +711,10 @@ func (fc *FunctionCall) TokenLiteral() string {
 	return fc.Token.Literal
 }
 
+func (fc *FunctionCall) Span() token.Span {
+	return token.Span{Start: fc.Function.Span().Start, End: fc.End}
+}
+
 func (fc *FunctionCall) String() string {
 	var out bytes.Buffer
 	out.WriteString(fc.Function.String())
@@ -388,20 +730,57 @@ func (fc *FunctionCall) String() string {
 
 //Array Element
 type ArrObjElement struct {
-	Token token.Token //IDENT
+	Token token.Token //[
 	Name  Expression
 	Index Expression
+	End   token.Position //end of the closing ]
 }
 
 func (ae *ArrObjElement) expNode() {}
 func (ae *ArrObjElement) TokenLiteral() string {
 	return ae.Name.TokenLiteral()
 }
+func (ae *ArrObjElement) Span() token.Span {
+	return token.Span{Start: ae.Name.Span().Start, End: ae.End}
+}
 func (ae *ArrObjElement) String() string {
 	var out bytes.Buffer
-	out.WriteString(ae.Name.TokenLiteral())
+	out.WriteString(ae.Name.String())
 	out.WriteString("[")
-	out.WriteString(fmt.Sprint(ae.Index))
+	out.WriteString(ae.Index.String())
 	out.WriteString("]")
 	return out.String()
 }
+
+//Placeholders for code that failed to parse. The parser puts them where a node was expected, so the tree stays complete even with errors.
+type BadExpression struct {
+	Token token.Token //first token of the broken expression
+	End   token.Position
+}
+
+func (be *BadExpression) expNode() {}
+func (be *BadExpression) TokenLiteral() string {
+	return be.Token.Literal
+}
+func (be *BadExpression) Span() token.Span {
+	return token.Span{Start: be.Token.Pos, End: be.End}
+}
+func (be *BadExpression) String() string {
+	return "<bad expression>"
+}
+
+type BadStatement struct {
+	Token token.Token //first token of the broken statement
+	End   token.Position
+}
+
+func (bs *BadStatement) stateNode() {}
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BadStatement) Span() token.Span {
+	return token.Span{Start: bs.Token.Pos, End: bs.End}
+}
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
@@ -0,0 +1,147 @@
+package diag
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Revolyssup/monkey/token"
+)
+
+//Severity tells how serious a diagnostic is.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+//Every diagnostic carries one of these codes, so that tools can match on the kind of problem instead of the message text.
+//Codes starting with L come from the lexer, codes starting with P from the parser and codes starting with R from the evaluator.
+const (
+	UnterminatedString  = "L001"
+	InvalidEscape       = "L002"
+	InvalidUTF8         = "L003"
+	UnterminatedComment = "L004"
+
+	UnexpectedToken    = "P001"
+	NoPrefixParse      = "P002"
+	InvalidLiteral     = "P003"
+	MissingComma       = "P004"
+	MissingSeparator   = "P005"
+	IllegalCharacter   = "P006"
+	InvalidTarget      = "P007"
+	OutsideLoop        = "P008"
+	EmptyInterpolation = "P009"
+	LiteralOutOfRange  = "P010"
+
+	RuntimeError = "R001"
+)
+
+//Diagnostic is a single problem found in the source, by the parser or by the evaluator.
+type Diagnostic struct {
+	Severity Severity
+	Span     token.Span
+	Code     string
+	Message  string
+	Hint     string //optional suggestion on how to fix the problem
+}
+
+//Errorf builds an error diagnostic for the given span.
+func Errorf(span token.Span, code string, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Severity: Error, Span: span, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+//One line summary like: test.mon:3:5: error[P001]: Expected token type ). Got ; instead
+func (d Diagnostic) String() string {
+	var out strings.Builder
+	if d.Span.Start.IsValid() || d.Span.Start.File != "" {
+		out.WriteString(d.Span.Start.String() + ": ")
+	}
+	out.WriteString(d.Severity.String())
+	if d.Code != "" {
+		out.WriteString("[" + d.Code + "]")
+	}
+	out.WriteString(": " + d.Message)
+	return out.String()
+}
+
+func (d Diagnostic) Error() string {
+	return d.String()
+}
+
+//Render writes the diagnostic along with the offending source line, with the span underlined by carets:
+//
+//	error[P001]: Expected token type ). Got ; instead
+//	 --> test.mon:1:15
+//	  |
+//	1 | let x = (1 + 2;
+//	  |               ^
+func Render(out io.Writer, source string, d Diagnostic) {
+	header := d.Severity.String()
+	if d.Code != "" {
+		header += "[" + d.Code + "]"
+	}
+	io.WriteString(out, header+": "+d.Message+"\n")
+
+	start := d.Span.Start
+	lines := strings.Split(source, "\n")
+	if !start.IsValid() || start.Line > len(lines) {
+		if d.Hint != "" {
+			io.WriteString(out, " = hint: "+d.Hint+"\n")
+		}
+		return
+	}
+	line := strings.TrimRight(lines[start.Line-1], "\r")
+	number := fmt.Sprint(start.Line)
+	gutter := strings.Repeat(" ", len(number))
+
+	fmt.Fprintf(out, "%s--> %s\n", gutter, start)
+	fmt.Fprintf(out, "%s |\n", gutter)
+	fmt.Fprintf(out, "%s | %s\n", number, line)
+	fmt.Fprintf(out, "%s | %s\n", gutter, underline(line, d.Span))
+	if d.Hint != "" {
+		fmt.Fprintf(out, "%s = hint: %s\n", gutter, d.Hint)
+	}
+}
+
+//underline returns the padding and carets that go below line to mark the span.
+//Tabs are kept in the padding so that the carets stay aligned with the source.
+func underline(line string, span token.Span) string {
+	chars := []rune(line) //columns count characters, not bytes
+	from := span.Start.Column - 1
+	if from > len(chars) {
+		from = len(chars)
+	}
+	to := len(chars)
+	if span.End.Line == span.Start.Line && span.End.Column-1 <= len(chars) {
+		to = span.End.Column - 1
+	}
+	width := to - from
+	if width < 1 {
+		width = 1
+	}
+
+	var out strings.Builder
+	for _, ch := range chars[:from] {
+		if ch == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	out.WriteString(strings.Repeat("^", width))
+	return out.String()
+}
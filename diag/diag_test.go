@@ -0,0 +1,62 @@
+package diag
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Revolyssup/monkey/token"
+)
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\n\tlet y = [1 2];"
+	d := Errorf(token.Span{
+		Start: token.Position{File: "test.mon", Offset: 21, Line: 2, Column: 11},
+		End:   token.Position{File: "test.mon", Offset: 24, Line: 2, Column: 14},
+	}, MissingComma, "No comma after element in array.")
+	d.Hint = "separate array elements with ','"
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+	expected := `error[P004]: No comma after element in array.
+ --> test.mon:2:11
+  |
+2 | 	let y = [1 2];
+  | 	         ^^^
+  = hint: separate array elements with ','
+`
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+	if d.String() != "test.mon:2:11: error[P004]: No comma after element in array." {
+		t.Errorf("wrong summary. got=%q", d.String())
+	}
+}
+
+func TestRenderAfterMultibyteCharacters(t *testing.T) {
+	source := `let größe = "é" +;`
+	d := Errorf(token.Span{
+		Start: token.Position{Offset: 21, Line: 1, Column: 18},
+		End:   token.Position{Offset: 22, Line: 1, Column: 19},
+	}, NoPrefixParse, "no prefix parse function for ;")
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+	expected := `error[P002]: no prefix parse function for ;
+ --> 1:18
+  |
+1 | let größe = "é" +;
+  |                  ^
+`
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRenderWithoutPosition(t *testing.T) {
+	var out bytes.Buffer
+	Render(&out, "1 + 1", Errorf(token.Span{}, RuntimeError, "something went wrong"))
+	expected := "error[R001]: something went wrong\n"
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=%q, got=%q", expected, out.String())
+	}
+}
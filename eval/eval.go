@@ -3,8 +3,10 @@ package eval
 import (
 	"bytes"
 	"fmt"
-	"strconv"
+	"math"
+	"math/big"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/Revolyssup/monkey/ast"
 	"github.com/Revolyssup/monkey/obj"
@@ -18,6 +20,12 @@ var fns = map[string]*obj.Builtin{
 	"print": {
 		Fn: print,
 	},
+	"range": {
+		Fn: rangeOf,
+	},
+	"to_string": {
+		Fn: toStringBuiltin,
+	},
 }
 
 //Because different "true" are not different so creating new instance everytime a bool instance is created is a waste of space. SO we point all booleans of one type
@@ -27,11 +35,21 @@ var (
 	FALSE = &obj.Boolean{Value: false}
 	NULL  = &obj.Null{}
 	// POSITIVE
+
+	//Signals of break and continue, they carry nothing either.
+	BREAK    = &obj.Break{}
+	CONTINUE = &obj.Continue{}
 )
 
 //It take in the AST ,starting from the root node. And depending on the type of Node, calls other functions which evaluate and then call Eval recursively.
 //Because all data type in AST implement Node interface ,ergo this works
-func Eval(node ast.Node, env *obj.Env) obj.Object {
+func Eval(node ast.Node, env *obj.Env) (result obj.Object) {
+	//The innermost node that produced an error is the one it gets blamed on.
+	defer func() {
+		if err, ok := result.(*obj.Error); ok && !err.Span.Start.IsValid() && node != nil {
+			err.Span = node.Span()
+		}
+	}()
 	switch node := node.(type) {
 	//If it is the root node
 	case *ast.Program:
@@ -49,10 +67,18 @@ func Eval(node ast.Node, env *obj.Env) obj.Object {
 		{
 			return &obj.Integer{Value: node.Value}
 		}
+	case *ast.FloatLiteral:
+		{
+			return &obj.Float{Value: node.Value}
+		}
 	case *ast.StringLiteral:
 		{
 			return &obj.String{Value: node.Value}
 		}
+	case *ast.InterpolatedString:
+		{
+			return evalInterpolatedString(node, env)
+		}
 	case *ast.Boolean:
 		{
 			return returnSingleBooleanInstance(node.Value)
@@ -61,27 +87,47 @@ func Eval(node ast.Node, env *obj.Env) obj.Object {
 		{
 			arr := &obj.Array{}
 			arr.Arr = evalExpressions(node.Value, env)
+			if len(arr.Arr) == 1 && isAbrupt(arr.Arr[0]) {
+				return arr.Arr[0]
+			}
 			return arr
 		}
 	case *ast.ObjectLiteral:
 		{
-			arr := &obj.Obj{}
-
-			arr.OBJ = evalMapExpressions(node.Value, env)
-			return arr
+			return evalObjectLiteral(node, env)
 		}
 		//Evaluating prefix expressions
 	case *ast.PrefixExpression:
 		{
 			evalRight := Eval(node.RightExpression, env)
+			if isAbrupt(evalRight) {
+				return evalRight
+			}
 			return evalPrefixExpression(node.Operator, evalRight)
 		}
 	case *ast.InfixExpression:
 		{
+			if node.Operator == "&&" || node.Operator == "||" {
+				return evalLogicalExpression(node, env)
+			}
 			evalLeft := Eval(node.LeftExpression, env)
+			if isAbrupt(evalLeft) {
+				return evalLeft
+			}
 			evalRight := Eval(node.RightExpression, env)
+			if isAbrupt(evalRight) {
+				return evalRight
+			}
 			return evalInfixExpression(node.Operator, evalLeft, evalRight)
 		}
+	case *ast.PostfixExpression:
+		{
+			return evalPostfixExpression(node, env)
+		}
+	case *ast.AssignExpression:
+		{
+			return evalAssignExpression(node, env)
+		}
 	case *ast.BlockStatement:
 		{
 			return evalBlockStatement(node, env)
@@ -94,11 +140,34 @@ func Eval(node ast.Node, env *obj.Env) obj.Object {
 		{
 			return evalForExpressions(node, env)
 		}
+	case *ast.ForInExpression:
+		{
+			return evalForInExpression(node, env)
+		}
+	case *ast.MatchExpression:
+		{
+			return evalMatchExpression(node, env)
+		}
+	case *ast.Wildcard:
+		{
+			return newErr("_ can only be used as a pattern in match")
+		}
 	case *ast.ReturnStatement:
 		{
 			val := Eval(node.ReturnValue, env)
+			if isAbrupt(val) {
+				return val
+			}
 			return &obj.Return{Value: val}
 		}
+	case *ast.BreakStatement:
+		{
+			return BREAK
+		}
+	case *ast.ContinueStatement:
+		{
+			return CONTINUE
+		}
 	case *ast.Identifier:
 		{
 
@@ -111,10 +180,14 @@ func Eval(node ast.Node, env *obj.Env) obj.Object {
 	case *ast.LetStatement:
 		{
 			val := Eval(node.Value, env)
-			if isError(val) {
+			if isAbrupt(val) { //let x = if (done) { break }
 				return val
 			}
-			env.Set(node.Name.Value, val)
+			//Functions are known by the first name they are bound to, for tracebacks.
+			if fn, ok := val.(*obj.Function); ok && fn.Name == "" {
+				fn.Name = node.Name.Value
+			}
+			env.Define(node.Name.Value, val)
 		}
 	case *ast.FunctionLiteral:
 		{
@@ -126,17 +199,21 @@ func Eval(node ast.Node, env *obj.Env) obj.Object {
 		{
 			//Create the function object
 			fn := Eval(node.Function, env)
-			if isError(fn) {
+			if isAbrupt(fn) {
 				return fn
 			}
 
 			//Create allt the argument objects
 			args := evalExpressions(node.Arguments, env)
 
-			if len(args) == 1 && isError(args[0]) {
+			if len(args) == 1 && isAbrupt(args[0]) {
 				return args[0]
 			}
-			return execFunction(fn, args)
+			return execFunction(fn, args, node, env)
+		}
+	case *ast.BadExpression, *ast.BadStatement:
+		{
+			return newErr("cannot evaluate code that failed to parse")
 		}
 
 	}
@@ -162,6 +239,9 @@ func evalStatements(stmts []ast.Statement, env *obj.Env) obj.Object {
 		if err, ok := result.(*obj.Error); ok {
 			return err
 		}
+		if err := loopSignalError(result); err != nil {
+			return err
+		}
 	}
 	return result // It actually consists of the result of last evaluated statement.
 }
@@ -176,11 +256,11 @@ func evalPrefixExpression(op string, right obj.Object) obj.Object {
 		}
 	case "-":
 		{
-			if right.DataType() != obj.INTEGER_OBJ { //Would be changed into switch case later. Based on datatype different methods will be called
-				return newErr("unknown operator: %s%s", op, right.DataType())
-			}
-			rightint := right.(*obj.Integer)
-			return evalMinusOperator(rightint)
+			return evalMinusOperator(right)
+		}
+	case "~":
+		{
+			return evalBitNotOperator(right)
 		}
 
 	default:
@@ -193,48 +273,58 @@ func evalPrefixExpression(op string, right obj.Object) obj.Object {
 
 //for different prefix operators.
 func evalBangOperator(right obj.Object) obj.Object {
-	switch right {
-	case TRUE:
-		{
-			return FALSE
-		}
-	case FALSE:
-		{
-			return TRUE
-		}
-	case NULL:
-		{
-			return TRUE
+	return returnSingleBooleanInstance(!isTruthy(right))
+}
+
+func evalMinusOperator(right obj.Object) obj.Object {
+	switch right := right.(type) {
+	case *obj.Integer:
+		if right.Value == math.MinInt64 {
+			return obj.NewInteger(new(big.Int).Neg(obj.ToBig(right)))
 		}
+		return &obj.Integer{Value: -right.Value}
+	case *obj.BigInteger:
+		return obj.NewInteger(new(big.Int).Neg(right.Value))
+	case *obj.Float:
+		return &obj.Float{Value: -right.Value}
 	default:
-		{
-			return FALSE
-		}
+		return newErr("unknown operator: -%s", right.DataType())
 	}
 }
 
-func evalMinusOperator(right *obj.Integer) obj.Object {
-	value := right.Value
-	ans := &obj.Integer{Value: -value}
-	return ans
+//~x flips every bit, so it is -x - 1, as integers are two's complement.
+func evalBitNotOperator(right obj.Object) obj.Object {
+	switch right := right.(type) {
+	case *obj.Integer:
+		return &obj.Integer{Value: ^right.Value}
+	case *obj.BigInteger:
+		return obj.NewInteger(new(big.Int).Not(right.Value))
+	default:
+		return newErr("unknown operator: ~%s", right.DataType())
+	}
 }
 
 /*********/
 //INFIX
 func evalInfixExpression(op string, left obj.Object, right obj.Object) obj.Object {
 	switch {
-	case left.DataType() != right.DataType():
-		{
-			return newErr("type mismatch: %s %s %s", left.DataType(), op, right.DataType())
-		}
-	// Directly compare the objects and return boolean. As all booleans are pointing to a single instance, it swiftly works for booleans
+	//Any two values can be compared for equality. Values of different types are simply not equal.
 	case op == "==":
 		{
-			return returnSingleBooleanInstance(left.Inspect() == right.Inspect())
+			return returnSingleBooleanInstance(left.Equal(right))
 		}
 	case op == "!=":
 		{
-			return returnSingleBooleanInstance(left.Inspect() != right.Inspect())
+			return returnSingleBooleanInstance(!left.Equal(right))
+		}
+	//As soon as one side is a float, the operation is done in floating point. Integers with integers stay integers, so 7 / 2 is 3.
+	case isNumber(left) && isNumber(right) && (left.DataType() == obj.FLOAT_OBJ || right.DataType() == obj.FLOAT_OBJ):
+		{
+			return evalFloat(op, left, right)
+		}
+	case left.DataType() != right.DataType():
+		{
+			return newErr("type mismatch: %s %s %s", left.DataType(), op, right.DataType())
 		}
 	//If we have integers on either side
 	case left.DataType() == obj.INTEGER_OBJ && right.DataType() == obj.INTEGER_OBJ:
@@ -254,27 +344,237 @@ func evalInfixExpression(op string, left obj.Object, right obj.Object) obj.Objec
 
 }
 
+//Integer arithmetic is done on int64 as long as the result fits. An operation that would overflow is done again on
+//big integers instead, so integers never silently wrap around.
+//Division truncates towards zero and % takes the sign of the dividend, so that a == (a / b) * b + a % b. -7 % 3 is -1.
+//Bitwise operators work on the two's complement of the value, and >> keeps the sign, so -8 >> 1 is -4.
 func evalInteger(op string, left obj.Object, right obj.Object) obj.Object {
-	leftVal := left.(*obj.Integer).Value
-	rightVal := right.(*obj.Integer).Value
+	l, leftSmall := left.(*obj.Integer)
+	r, rightSmall := right.(*obj.Integer)
+	if !leftSmall || !rightSmall {
+		return evalBigInteger(op, left, right)
+	}
+	leftVal := l.Value
+	rightVal := r.Value
 
 	switch op {
 	case "+":
 		{
-			return &obj.Integer{Value: leftVal + rightVal}
+			sum := leftVal + rightVal
+			if (leftVal^sum)&(rightVal^sum) < 0 { //the sign of the result differs from both operands
+				return evalBigInteger(op, left, right)
+			}
+			return &obj.Integer{Value: sum}
 		}
 	case "-":
 		{
-			return &obj.Integer{Value: leftVal - rightVal}
+			diff := leftVal - rightVal
+			if (leftVal^rightVal)&(leftVal^diff) < 0 {
+				return evalBigInteger(op, left, right)
+			}
+			return &obj.Integer{Value: diff}
 		}
 	case "*":
 		{
-			return &obj.Integer{Value: leftVal * rightVal}
+			product := leftVal * rightVal
+			if leftVal != 0 && (product/leftVal != rightVal || leftVal == -1 && rightVal == math.MinInt64) {
+				return evalBigInteger(op, left, right)
+			}
+			return &obj.Integer{Value: product}
 		}
 	case "/":
 		{
+			if rightVal == 0 {
+				return newErr("division by zero")
+			}
+			if leftVal == math.MinInt64 && rightVal == -1 {
+				return evalBigInteger(op, left, right)
+			}
 			return &obj.Integer{Value: leftVal / rightVal}
 		}
+	case "%":
+		{
+			if rightVal == 0 {
+				return newErr("modulo by zero")
+			}
+			return &obj.Integer{Value: leftVal % rightVal}
+		}
+	case "&":
+		{
+			return &obj.Integer{Value: leftVal & rightVal}
+		}
+	case "|":
+		{
+			return &obj.Integer{Value: leftVal | rightVal}
+		}
+	case "^":
+		{
+			return &obj.Integer{Value: leftVal ^ rightVal}
+		}
+	case "<<":
+		{
+			if rightVal < 0 {
+				return newErr("negative shift count: %d", rightVal)
+			}
+			if rightVal >= 63 || leftVal<<rightVal>>rightVal != leftVal { //bits would be shifted out
+				return evalBigInteger(op, left, right)
+			}
+			return &obj.Integer{Value: leftVal << rightVal}
+		}
+	case ">>":
+		{
+			if rightVal < 0 {
+				return newErr("negative shift count: %d", rightVal)
+			}
+			if rightVal > 63 {
+				rightVal = 63 //only the sign is left
+			}
+			return &obj.Integer{Value: leftVal >> rightVal}
+		}
+	case "<":
+		{
+			return returnSingleBooleanInstance(leftVal < rightVal)
+		}
+	case ">":
+		{
+			return returnSingleBooleanInstance(leftVal > rightVal)
+		}
+	case "<=":
+		{
+			return returnSingleBooleanInstance(leftVal <= rightVal)
+		}
+	case ">=":
+		{
+			return returnSingleBooleanInstance(leftVal >= rightVal)
+		}
+	default:
+		return newErr("unknown operator: %s %s %s",
+			left.DataType(), op, right.DataType())
+	}
+
+}
+
+//maxShift bounds the shift count on big integers, as 1 << n takes n bits of memory.
+const maxShift = 1 << 20
+
+//Same as evalInteger, for when at least one side is, or the result may be, too large for an int64.
+//Results are turned back into an Integer whenever they fit.
+func evalBigInteger(op string, left obj.Object, right obj.Object) obj.Object {
+	leftVal := obj.ToBig(left)
+	rightVal := obj.ToBig(right)
+
+	switch op {
+	case "+":
+		{
+			return obj.NewInteger(leftVal.Add(leftVal, rightVal))
+		}
+	case "-":
+		{
+			return obj.NewInteger(leftVal.Sub(leftVal, rightVal))
+		}
+	case "*":
+		{
+			return obj.NewInteger(leftVal.Mul(leftVal, rightVal))
+		}
+	case "/":
+		{
+			if rightVal.Sign() == 0 {
+				return newErr("division by zero")
+			}
+			return obj.NewInteger(leftVal.Quo(leftVal, rightVal)) //Quo and Rem truncate, like int64 division
+		}
+	case "%":
+		{
+			if rightVal.Sign() == 0 {
+				return newErr("modulo by zero")
+			}
+			return obj.NewInteger(leftVal.Rem(leftVal, rightVal))
+		}
+	case "&":
+		{
+			return obj.NewInteger(leftVal.And(leftVal, rightVal))
+		}
+	case "|":
+		{
+			return obj.NewInteger(leftVal.Or(leftVal, rightVal))
+		}
+	case "^":
+		{
+			return obj.NewInteger(leftVal.Xor(leftVal, rightVal))
+		}
+	case "<<", ">>":
+		{
+			if rightVal.Sign() < 0 {
+				return newErr("negative shift count: %s", rightVal)
+			}
+			tooLarge := !rightVal.IsInt64() || rightVal.Int64() > maxShift
+			if op == "<<" {
+				if tooLarge {
+					return newErr("shift count too large: %s", rightVal)
+				}
+				return obj.NewInteger(leftVal.Lsh(leftVal, uint(rightVal.Int64())))
+			}
+			if tooLarge {
+				return &obj.Integer{Value: int64(leftVal.Sign() >> 1)} //every bit is shifted out, only the sign is left
+			}
+			return obj.NewInteger(leftVal.Rsh(leftVal, uint(rightVal.Int64()))) //Rsh rounds down, like >> on an int64
+		}
+	case "<":
+		{
+			return returnSingleBooleanInstance(leftVal.Cmp(rightVal) < 0)
+		}
+	case ">":
+		{
+			return returnSingleBooleanInstance(leftVal.Cmp(rightVal) > 0)
+		}
+	case "<=":
+		{
+			return returnSingleBooleanInstance(leftVal.Cmp(rightVal) <= 0)
+		}
+	case ">=":
+		{
+			return returnSingleBooleanInstance(leftVal.Cmp(rightVal) >= 0)
+		}
+	default:
+		return newErr("unknown operator: %s %s %s",
+			left.DataType(), op, right.DataType())
+	}
+}
+
+func evalFloat(op string, left obj.Object, right obj.Object) obj.Object {
+	if res := compareMixed(op, left, right); res != nil {
+		return res
+	}
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch op {
+	case "+":
+		{
+			return &obj.Float{Value: leftVal + rightVal}
+		}
+	case "-":
+		{
+			return &obj.Float{Value: leftVal - rightVal}
+		}
+	case "*":
+		{
+			return &obj.Float{Value: leftVal * rightVal}
+		}
+	case "/":
+		{
+			if rightVal == 0 {
+				return newErr("division by zero")
+			}
+			return &obj.Float{Value: leftVal / rightVal}
+		}
+	case "%":
+		{
+			if rightVal == 0 {
+				return newErr("modulo by zero")
+			}
+			return &obj.Float{Value: math.Mod(leftVal, rightVal)}
+		}
 	case "<":
 		{
 			return returnSingleBooleanInstance(leftVal < rightVal)
@@ -283,19 +583,69 @@ func evalInteger(op string, left obj.Object, right obj.Object) obj.Object {
 		{
 			return returnSingleBooleanInstance(leftVal > rightVal)
 		}
-	case "==":
+	case "<=":
 		{
-			return returnSingleBooleanInstance(leftVal == rightVal)
+			return returnSingleBooleanInstance(leftVal <= rightVal)
 		}
-	case "!=":
+	case ">=":
 		{
-			return returnSingleBooleanInstance(leftVal != rightVal)
+			return returnSingleBooleanInstance(leftVal >= rightVal)
 		}
 	default:
 		return newErr("unknown operator: %s %s %s",
 			left.DataType(), op, right.DataType())
 	}
+}
+
+func isNumber(ob obj.Object) bool {
+	return ob.DataType() == obj.INTEGER_OBJ || ob.DataType() == obj.FLOAT_OBJ
+}
 
+//toFloat widens an integer to a float. It must only be called on numbers.
+func toFloat(ob obj.Object) float64 {
+	switch ob := ob.(type) {
+	case *obj.Integer:
+		return float64(ob.Value)
+	case *obj.BigInteger:
+		f, _ := new(big.Float).SetInt(ob.Value).Float64()
+		return f
+	}
+	return ob.(*obj.Float).Value
+}
+
+//compareMixed orders an integer and a float exactly, the same way == compares them, as turning a large integer into
+//a float rounds it. It returns nil for any other operands or operator, which are left to float64.
+func compareMixed(op string, left obj.Object, right obj.Object) obj.Object {
+	if left.DataType() == right.DataType() {
+		return nil
+	}
+	leftVal, rightVal := toBigFloat(left), toBigFloat(right)
+	if leftVal == nil || rightVal == nil { //NaN, which is not ordered
+		return nil
+	}
+	cmp := leftVal.Cmp(rightVal)
+	switch op {
+	case "<":
+		return returnSingleBooleanInstance(cmp < 0)
+	case ">":
+		return returnSingleBooleanInstance(cmp > 0)
+	case "<=":
+		return returnSingleBooleanInstance(cmp <= 0)
+	case ">=":
+		return returnSingleBooleanInstance(cmp >= 0)
+	}
+	return nil
+}
+
+//toBigFloat holds any number without rounding it. It returns nil for NaN, which big.Float cannot hold.
+func toBigFloat(ob obj.Object) *big.Float {
+	if f, ok := ob.(*obj.Float); ok {
+		if math.IsNaN(f.Value) {
+			return nil
+		}
+		return big.NewFloat(f.Value)
+	}
+	return new(big.Float).SetInt(obj.ToBig(ob))
 }
 
 func evalString(op string, left obj.Object, right obj.Object) obj.Object {
@@ -326,11 +676,33 @@ func evalString(op string, left obj.Object, right obj.Object) obj.Object {
 
 }
 
+//&& and || only evaluate their right side when the left side does not already decide the result.
+func evalLogicalExpression(node *ast.InfixExpression, env *obj.Env) obj.Object {
+	left := Eval(node.LeftExpression, env)
+	if isAbrupt(left) {
+		return left
+	}
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+	right := Eval(node.RightExpression, env)
+	if isAbrupt(right) {
+		return right
+	}
+	return returnSingleBooleanInstance(isTruthy(right))
+}
+
 /***********/
 //IF
 
 func evalIfExpression(node *ast.IfExpression, env *obj.Env) obj.Object {
 	cond := Eval(node.Condition, env)
+	if isAbrupt(cond) {
+		return cond
+	}
 	if isTruthy((cond)) {
 		return Eval(node.MainStmt, env)
 	} else if node.AltStmt != nil {
@@ -339,36 +711,256 @@ func evalIfExpression(node *ast.IfExpression, env *obj.Env) obj.Object {
 	return NULL
 }
 
-//FOR- Similar to If, just goes back, instead of continuing
-func evalForExpressions(node *ast.ForExpression, env *obj.Env) obj.Object {
-	cond := Eval(node.Condition, env)
-	var ans obj.Object
-	for isTruthy(cond) {
-		ans = Eval(node.Stmt, env)
-		cond = Eval(node.Condition, env)
+//Each arm gets its own scope, so that variables bound by its pattern do not leak out of it.
+func evalMatchExpression(node *ast.MatchExpression, env *obj.Env) obj.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
 	}
-	return ans
+	for _, arm := range node.Arms {
+		armEnv := obj.NewEnclosedEnvironment(env)
+		matched, err := matchPattern(arm.Pattern, val, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, armEnv)
+	}
+	return newErr("no match arm matches %s", val.Inspect())
 }
-func isTruthy(object obj.Object) bool {
-	switch object {
-	case NULL:
-		{
-			return false
+
+//matchPattern reports whether val has the shape of pattern, and binds the variables the pattern names in env.
+//	_           matches anything
+//	x           matches anything and binds it to x
+//	[p1, p2]    matches arrays of exactly that length whose elements match
+//	{{k: p}}    matches objects that have all the keys, with values that match. Other keys are ignored
+//Any other expression is evaluated and matches values equal to it.
+func matchPattern(pattern ast.Expression, val obj.Object, env *obj.Env) (bool, obj.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.Wildcard:
+		return true, nil
+	case *ast.Identifier:
+		env.Define(pattern.Value, val)
+		return true, nil
+	case *ast.ArrayLiteral:
+		arr, ok := val.(*obj.Array)
+		if !ok || len(arr.Arr) != len(pattern.Value) {
+			return false, nil
 		}
-	case TRUE:
-		{
-			return true
+		for i, elem := range pattern.Value {
+			if matched, err := matchPattern(elem, arr.Arr[i], env); !matched || err != nil {
+				return false, err
+			}
 		}
-	case FALSE:
-		{
-			return false
+		return true, nil
+	case *ast.ObjectLiteral:
+		object, ok := val.(*obj.Obj)
+		if !ok {
+			return false, nil
+		}
+		for _, pair := range pattern.Pairs {
+			key := Eval(pair.Key, env)
+			if isAbrupt(key) {
+				return false, key
+			}
+			hashable, err := objectKey(key)
+			if err != nil {
+				err.Span = pair.Key.Span()
+				return false, err
+			}
+			field, ok := object.Get(hashable)
+			if !ok {
+				return false, nil
+			}
+			if matched, err := matchPattern(pair.Value, field, env); !matched || err != nil {
+				return false, err
+			}
 		}
+		return true, nil
 	default:
-		{
-			return false
+		expected := Eval(pattern, env)
+		if isAbrupt(expected) {
+			return false, expected
+		}
+		return expected.Equal(val), nil
+	}
+}
+
+//The loop evaluates to the value of the last iteration that ran to its end, or null if there was none.
+//A return or an error in the body stops the loop and is passed on, break stops it and continue skips to the next iteration.
+//
+//In the C style form, a variable declared by the init belongs to the loop, and every iteration gets its own copy of it,
+//taken before the update runs. So a closure made in the body keeps the value the variable had in that iteration.
+func evalForExpressions(node *ast.ForExpression, env *obj.Env) obj.Object {
+	var ans obj.Object = NULL
+	iterEnv := env
+	loopVar := ""
+	if node.Init != nil {
+		iterEnv = obj.NewEnclosedEnvironment(env)
+		if init := Eval(node.Init, iterEnv); isAbrupt(init) {
+			return init
+		}
+		if let, ok := node.Init.(*ast.LetStatement); ok {
+			loopVar = let.Name.Value
+		}
+	}
+	for first := true; ; first = false {
+		if !first && loopVar != "" {
+			val, _ := iterEnv.Get(loopVar)
+			iterEnv = obj.NewEnclosedEnvironment(env)
+			iterEnv.Define(loopVar, val)
+		}
+		if !first && node.Update != nil {
+			if update := Eval(node.Update, iterEnv); isAbrupt(update) {
+				return update
+			}
+		}
+		if node.Condition != nil {
+			cond := Eval(node.Condition, iterEnv)
+			if isAbrupt(cond) {
+				return cond
+			}
+			if !isTruthy(cond) {
+				return ans
+			}
+		}
+		if loopStep(Eval(node.Stmt, iterEnv), &ans) {
+			return ans
+		}
+	}
+}
+
+//for (x in it) and for (k, v in it) go over:
+//	arrays      x is the element,   k, v the index and the element
+//	objects     x is the key,       k, v the key and the value, in insertion order
+//	strings     x is the character, k, v the index and the character
+//	ranges      x is the number,    k, v the index and the number
+//Every iteration runs in a scope of its own with new variables.
+func evalForInExpression(node *ast.ForInExpression, env *obj.Env) obj.Object {
+	iterable := Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	var ans obj.Object = NULL
+	step := func(key, val obj.Object) bool {
+		iterEnv := obj.NewEnclosedEnvironment(env)
+		if len(node.Vars) == 1 {
+			iterEnv.Define(node.Vars[0].Value, val)
+		} else {
+			iterEnv.Define(node.Vars[0].Value, key)
+			iterEnv.Define(node.Vars[1].Value, val)
+		}
+		return loopStep(Eval(node.Stmt, iterEnv), &ans)
+	}
+
+	switch iterable := iterable.(type) {
+	case *obj.Array:
+		for i := 0; i < len(iterable.Arr); i++ { //elements appended by the body are visited too
+			if step(&obj.Integer{Value: int64(i)}, iterable.Arr[i]) {
+				break
+			}
 		}
+	case *obj.Obj:
+		for _, pair := range iterable.Pairs() {
+			key, val := obj.Object(pair.Key), pair.Value
+			if len(node.Vars) == 1 {
+				val = key
+			}
+			if step(key, val) {
+				break
+			}
+		}
+	case *obj.String:
+		for i, ch := range []rune(iterable.Value) {
+			if step(&obj.Integer{Value: int64(i)}, &obj.String{Value: string(ch)}) {
+				break
+			}
+		}
+	case *obj.Range:
+		for i := int64(0); i < iterable.Len(); i++ {
+			if step(&obj.Integer{Value: i}, &obj.Integer{Value: iterable.At(i)}) {
+				break
+			}
+		}
+	default:
+		return newErr("cannot iterate over %s", iterable.DataType())
+	}
+	return ans
+}
+
+//loopStep handles what one iteration of a loop body evaluated to. It keeps the value of the loop in ans,
+//and reports whether the loop has to stop, in which case ans holds what the loop evaluates to.
+func loopStep(result obj.Object, ans *obj.Object) (stop bool) {
+	switch {
+	case result == BREAK:
+		return true
+	case result == CONTINUE:
+		return false
+	case result != nil && (result.DataType() == obj.RETURN_OBJ || result.DataType() == obj.ERROR_OBJ):
+		*ans = result
+		return true
+	case result != nil:
+		*ans = result
 	}
+	return false
+}
+
+func isLoopSignal(ob obj.Object) bool {
+	return ob == BREAK || ob == CONTINUE
+}
+
+//isAbrupt reports whether ob stops the evaluation of the expression it came out of: an error, or a break or continue
+//from an if used as a value, as in f(if (done) { break } else { x }), on its way up to its loop.
+func isAbrupt(ob obj.Object) bool {
+	return isError(ob) || isLoopSignal(ob)
+}
 
+//loopSignalError turns a break or continue that got out of every loop into an error. The parser rejects such code,
+//so this only happens for trees that were not built by it.
+func loopSignalError(ob obj.Object) *obj.Error {
+	if !isLoopSignal(ob) {
+		return nil
+	}
+	return newErr("%s outside of a loop", ob.Inspect())
+}
+
+//isTruthy decides which branch if takes, how long for loops, and what !, && and || see. These values are falsy:
+//false, null, the number zero (0 and 0.0), the empty string, the empty array, the empty object and the empty range.
+//Everything else, functions included, is truthy.
+func isTruthy(object obj.Object) bool {
+	switch object := object.(type) {
+	case *obj.Boolean:
+		return object.Value
+	case *obj.Null:
+		return false
+	case *obj.Integer:
+		return object.Value != 0
+	case *obj.BigInteger:
+		return object.Value.Sign() != 0
+	case *obj.Float:
+		return object.Value != 0
+	case *obj.String:
+		return object.Value != ""
+	case *obj.Array:
+		return len(object.Arr) != 0
+	case *obj.Obj:
+		return object.Len() != 0
+	case *obj.Range:
+		return object.Len() != 0
+	default:
+		return true
+	}
 }
 
 /***************/
@@ -379,7 +971,7 @@ func evalBlockStatement(block *ast.BlockStatement, env *obj.Env) obj.Object {
 	for _, stmt := range block.Stmts {
 		result = Eval(stmt, env)
 
-		if result != nil && result.DataType() == obj.RETURN_OBJ || result.DataType() == obj.ERROR_OBJ {
+		if result != nil && (result.DataType() == obj.RETURN_OBJ || result.DataType() == obj.ERROR_OBJ || isLoopSignal(result)) {
 			return result
 		}
 	}
@@ -417,30 +1009,213 @@ func evalIdentifiers(node *ast.Identifier, env *obj.Env) obj.Object {
 	return val
 }
 
-func evalObjArrayElement(node *ast.ArrObjElement, env *obj.Env) obj.Object {
-	name := node.Name
-	val, ok := env.Get(name.String())
-	if !ok {
-		return newErr("Array or Object with name %s not found", name.String())
+//Assignment changes the variable in the scope it was declared in, which may be outside of the current function.
+//For compound assignments like x += 1, the operator without the = is applied to the old value and the new one first.
+func evalAssignExpression(node *ast.AssignExpression, env *obj.Env) obj.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	op := strings.TrimSuffix(node.Operator, "=")
+	if op == "" {
+		return assign(node.Target, val, env)
+	}
+	_, res := update(node.Target, env, func(old obj.Object) obj.Object {
+		return evalInfixExpression(op, old, val)
+	})
+	return res
+}
 
+//x++ and x-- add or subtract one from a number, and evaluate to the value from before.
+func evalPostfixExpression(node *ast.PostfixExpression, env *obj.Env) obj.Object {
+	old, res := update(node.LeftExpression, env, func(old obj.Object) obj.Object {
+		if !isNumber(old) {
+			return newErr("unknown operator: %s%s", old.DataType(), node.Operator)
+		}
+		return evalInfixExpression(node.Operator[:1], old, &obj.Integer{Value: 1})
+	})
+	if isError(res) {
+		return res
 	}
-	val2, ok := val.(*obj.Array)
-	if !ok {
-		val3, ok := val.(*obj.Obj)
-		if !ok {
-			return newErr("Index operation requires array or object!")
+	return old
+}
+
+//update reads target, works out its new value with apply and stores it. The container and index of an element target
+//are evaluated only once, so a[f()] += 1 calls f once and writes to the element it read.
+//It returns the old value and the new one, or an error as the new one.
+func update(target ast.Expression, env *obj.Env, apply func(old obj.Object) obj.Object) (obj.Object, obj.Object) {
+	if target, ok := target.(*ast.ArrObjElement); ok {
+		ref, err := resolveElement(target, env)
+		if err != nil {
+			return err, err
+		}
+		old := ref.get()
+		val := apply(old)
+		if !isError(val) {
+			ref.set(val)
+		}
+		return old, val
+	}
+	if target, ok := target.(*ast.Identifier); ok {
+		if _, ok := env.Get(target.Value); !ok {
+			err := newErr("cannot assign to undeclared variable: %s", target.Value)
+			return err, err
 		}
-		return val3.OBJ[node.Index.String()]
 	}
-	i, err := strconv.Atoi(node.Index.String())
-	if err != nil {
-		return newErr("Index is not an integer")
+	old := Eval(target, env)
+	if isError(old) {
+		return old, old
 	}
-	if i >= len(val2.Arr) {
-		return newErr("Index out of bound")
+	val := apply(old)
+	if isError(val) {
+		return old, val
+	}
+	return old, assign(target, val, env)
+}
+
+//assign stores val in the variable or element target names. The parser makes sure that target is assignable.
+func assign(target ast.Expression, val obj.Object, env *obj.Env) obj.Object {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		if _, ok := env.Assign(target.Value, val); !ok {
+			return newErr("cannot assign to undeclared variable: %s", target.Value)
+		}
+		return val
+	case *ast.ArrObjElement:
+		ref, err := resolveElement(target, env)
+		if err != nil {
+			return err
+		}
+		ref.set(val)
+		return val
+	default:
+		return newErr("cannot assign to %s", target.String())
+	}
+}
+
+//elementRef is an element of an array or an object, found by evaluating the container and the index of a target.
+//Writing to it changes the array or object in place, so every variable holding it sees the change.
+type elementRef struct {
+	arr    *obj.Array
+	i      int
+	object *obj.Obj
+	key    obj.Hashable
+}
+
+//resolveElement evaluates the container and the index of target. The container can be any expression, which makes
+//nested targets like a[1]["k"] work.
+func resolveElement(target *ast.ArrObjElement, env *obj.Env) (*elementRef, obj.Object) {
+	container := Eval(target.Name, env)
+	if isAbrupt(container) {
+		return nil, container
+	}
+	index := Eval(target.Index, env)
+	if isAbrupt(index) {
+		return nil, index
+	}
+	switch container := container.(type) {
+	case *obj.Array:
+		i, err := arrayIndex(container, index)
+		if err != nil {
+			return nil, err
+		}
+		return &elementRef{arr: container, i: i}, nil
+	case *obj.Obj:
+		key, err := objectKey(index)
+		if err != nil {
+			return nil, err
+		}
+		return &elementRef{object: container, key: key}, nil
+	default:
+		return nil, newErr("index assignment requires array or object, got %s", container.DataType())
+	}
+}
+
+//A key that is not in the object reads as null.
+func (ref *elementRef) get() obj.Object {
+	if ref.arr != nil {
+		return ref.arr.Arr[ref.i]
+	}
+	if val, ok := ref.object.Get(ref.key); ok {
+		return val
+	}
+	return NULL
+}
+
+func (ref *elementRef) set(val obj.Object) {
+	if ref.arr != nil {
+		ref.arr.Arr[ref.i] = val
+		return
+	}
+	ref.object.Set(ref.key, val) //new keys are inserted
+}
+
+//Both the container and the index are ordinary expressions, so f()[0], a[i + 1] and obj[key] all work.
+func evalObjArrayElement(node *ast.ArrObjElement, env *obj.Env) obj.Object {
+	container := Eval(node.Name, env)
+	if isAbrupt(container) {
+		return container
+	}
+	index := Eval(node.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+	switch container := container.(type) {
+	case *obj.Array:
+		i, err := arrayIndex(container, index)
+		if err != nil {
+			return err
+		}
+		return container.Arr[i]
+	case *obj.Obj:
+		key, err := objectKey(index)
+		if err != nil {
+			return err
+		}
+		if val, ok := container.Get(key); ok {
+			return val
+		}
+		return NULL
+	case *obj.String:
+		chars := []rune(container.Value)
+		i, err := sequenceIndex("string", len(chars), index)
+		if err != nil {
+			return err
+		}
+		return &obj.String{Value: string(chars[i])}
+	default:
+		return newErr("index operation requires array, object or string, got %s", container.DataType())
 	}
-	ans := val2.Arr[i]
-	return ans
+}
+
+//arrayIndex checks that index can be used on arr. Negative indexes count from the end, so -1 is the last element.
+func arrayIndex(arr *obj.Array, index obj.Object) (int, *obj.Error) {
+	return sequenceIndex("array", len(arr.Arr), index)
+}
+
+//sequenceIndex checks index against a sequence of n elements, an array or the characters of a string.
+func sequenceIndex(kind string, n int, index obj.Object) (int, *obj.Error) {
+	i, ok := index.(*obj.Integer)
+	if !ok {
+		return 0, newErr("%s index must be an integer, got %s", kind, index.DataType())
+	}
+	pos := i.Value
+	if pos < 0 {
+		pos += int64(n)
+	}
+	if pos < 0 || pos >= int64(n) {
+		return 0, newErr("index %d out of range for %s of length %d", i.Value, kind, n)
+	}
+	return int(pos), nil
+}
+
+//objectKey checks that index can be used as a key in an object.
+func objectKey(index obj.Object) (obj.Hashable, *obj.Error) {
+	key, ok := index.(obj.Hashable)
+	if !ok {
+		return nil, newErr("unusable as object key: %s", index.DataType())
+	}
+	return key, nil
 }
 
 /****************/
@@ -451,24 +1226,59 @@ func evalExpressions(node []ast.Expression, env *obj.Env) []obj.Object {
 
 	for _, exp := range node {
 		evaluated := Eval(exp, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []obj.Object{evaluated}
 		}
 		exps = append(exps, evaluated)
 	}
 	return exps
 }
-func evalMapExpressions(node map[ast.Expression]ast.Expression, env *obj.Env) map[string]obj.Object {
-	exps := map[string]obj.Object{}
 
-	for key, exp := range node {
-		evaluated := Eval(exp, env)
-		if isError(evaluated) {
-			return map[string]obj.Object{key.String(): evaluated}
+//The values are evaluated left to right and turned into text the same way to_string does.
+func evalInterpolatedString(node *ast.InterpolatedString, env *obj.Env) obj.Object {
+	var out strings.Builder
+	for i, text := range node.Texts {
+		out.WriteString(text)
+		if i == len(node.Values) {
+			break
+		}
+		val := Eval(node.Values[i], env)
+		if isAbrupt(val) {
+			return val
 		}
-		exps[key.String()] = evaluated
+		out.WriteString(toString(val))
 	}
-	return exps
+	return &obj.String{Value: out.String()}
+}
+
+//toString is the text of a value, as used by to_string and string interpolation. Strings are taken as they are, without quotes.
+func toString(ob obj.Object) string {
+	if s, ok := ob.(*obj.String); ok {
+		return s.Value
+	}
+	return ob.Inspect()
+}
+
+//Entries are evaluated left to right, key before value. Keys are evaluated like any other expression, and have to be hashable.
+func evalObjectLiteral(node *ast.ObjectLiteral, env *obj.Env) obj.Object {
+	object := obj.NewObj()
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
+		}
+		hashable, err := objectKey(key)
+		if err != nil {
+			err.Span = pair.Key.Span()
+			return err
+		}
+		val := Eval(pair.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		object.Set(hashable, val)
+	}
+	return object
 }
 
 //This function will do two things:
@@ -477,7 +1287,7 @@ func evalMapExpressions(node map[ast.Expression]ast.Expression, env *obj.Env) ma
 func extendFun(fn *obj.Function, args []obj.Object) *obj.Env {
 	env := obj.NewEnclosedEnvironment(fn.Env)
 	for i, param := range fn.Args {
-		env.Set(param.Value, args[i])
+		env.Define(param.Value, args[i])
 	}
 	return env
 }
@@ -490,8 +1300,9 @@ func unwrapReturnValue(ob obj.Object) obj.Object {
 	return ob
 }
 
-//Executing the function
-func execFunction(fn obj.Object, args []obj.Object) obj.Object {
+//Executing the function. While it runs, a frame for it sits on the call stack, so that errors raised inside can
+//record which calls led to them.
+func execFunction(fn obj.Object, args []obj.Object, call *ast.FunctionCall, env *obj.Env) obj.Object {
 	function, ok := fn.(*obj.Function)
 	if !ok {
 		builin, ok2 := fn.(*obj.Builtin)
@@ -500,9 +1311,27 @@ func execFunction(fn obj.Object, args []obj.Object) obj.Object {
 		}
 		return newErr("not a function: %s", fn.DataType())
 	}
+	if len(args) != len(function.Args) {
+		return newErr("wrong number of arguments. got=%d, want=%d", len(args), len(function.Args))
+	}
+	name := function.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	stack := env.CallStack()
+	stack.Push(obj.Frame{Name: name, Pos: call.Span().Start})
+	defer stack.Pop()
+
 	newenv := extendFun(function, args)
-	evaluated := Eval(function.Body, newenv)
-	return unwrapReturnValue(evaluated)
+	evaluated := unwrapReturnValue(Eval(function.Body, newenv))
+	if err := loopSignalError(evaluated); err != nil {
+		err.Span = function.Body.Span()
+		evaluated = err
+	}
+	if err, ok := evaluated.(*obj.Error); ok && err.Stack == nil {
+		err.Stack = stack.Frames()
+	}
+	return evaluated
 }
 
 /***Built in functions in Monkey*****/
@@ -515,7 +1344,7 @@ func length(args ...obj.Object) obj.Object {
 	if !ok {
 		return &obj.Error{ErrMsg: "No string in arguments"}
 	}
-	return &obj.Integer{Value: int64(len(s.Value))}
+	return &obj.Integer{Value: int64(utf8.RuneCountInString(s.Value))} //characters, not bytes
 }
 
 func print(args ...obj.Object) obj.Object {
@@ -526,3 +1355,36 @@ func print(args ...obj.Object) obj.Object {
 	fmt.Println(out.String())
 	return &obj.Null{}
 }
+
+func toStringBuiltin(args ...obj.Object) obj.Object {
+	if len(args) != 1 {
+		return newErr("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	return &obj.String{Value: toString(args[0])}
+}
+
+//range(end), range(start, end) and range(start, end, step), like python's.
+func rangeOf(args ...obj.Object) obj.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newErr("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+	bounds := []int64{}
+	for _, arg := range args {
+		n, ok := arg.(*obj.Integer)
+		if !ok {
+			return newErr("range arguments must be integers, got %s", arg.DataType())
+		}
+		bounds = append(bounds, n.Value)
+	}
+	r := &obj.Range{End: bounds[0], Step: 1}
+	if len(bounds) > 1 {
+		r.Start, r.End = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		r.Step = bounds[2]
+	}
+	if r.Step == 0 {
+		return newErr("range step must not be zero")
+	}
+	return r
+}
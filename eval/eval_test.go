@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/Revolyssup/monkey/ast"
+	"github.com/Revolyssup/monkey/diag"
 	"github.com/Revolyssup/monkey/lexer"
 	"github.com/Revolyssup/monkey/obj"
 	"github.com/Revolyssup/monkey/parser"
@@ -54,6 +56,19 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 1", true},
+		{"(9223372036854775807 + 1) >= 9223372036854775807", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -124,6 +139,11 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"let x = 2; if (x == 1) { 10 } else if (x == 2) { 20 } else { 30 }", 20},
+		{"let x = 3; if (x == 1) { 10 } else if (x == 2) { 20 } else { 30 }", 30},
+		{"let x = 3; if (x == 1) { 10 } else if (x == 2) { 20 }", nil},
+		{"let x = 3; if (x == 1) { 10 } else if (x == 2) { 20 } else if (x == 3) { 30 } else { 40 }", 30},
+		{"let f = fn(x) { if (x == 1) { return 10 } else if (x == 2) { return 20 }; 30 }; f(2)", 20},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -224,6 +244,14 @@ func TestErrorHandling(t *testing.T) {
 			"foobar",
 			"Undefined variable: foobar",
 		},
+		{
+			"let = 5;",
+			"cannot evaluate code that failed to parse",
+		},
+		{
+			"let x = if { 10 }; x",
+			"cannot evaluate code that failed to parse",
+		},
 	}
 
 	for _, tt := range tests {
@@ -325,6 +353,39 @@ func TestStringConcatenation(t *testing.T) {
 		t.Errorf("String has wrong value. got=%q", str.Value)
 	}
 }
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let user = {{"name": "Ann"}}; let count = 3; "Hello ${user["name"]}, you have ${count} items"`, "Hello Ann, you have 3 items"},
+		{`"${1 + 1.5} ${true} ${[1, "a"]} ${if (false) { 1 }}"`, "2.5 true [1,a,] null"},
+		{`let x = 2; "${x}${x * x}"`, "24"},
+		{`"outer ${ "inner ${1 + 2}" }"`, "outer inner 3"},
+		{`let i = 0; "${i++} ${i++} ${i}"`, "0 1 2"},
+		{`"\${not} ${"}"}"`, "${not} }"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*obj.String)
+		if !ok {
+			t.Fatalf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: String has wrong value. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	evaluated := testEval(`"a ${missing} b"`)
+	err, ok := evaluated.(*obj.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if err.ErrMsg != "Undefined variable: missing" {
+		t.Errorf("wrong error message. got=%q", err.ErrMsg)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -333,6 +394,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("😀")`, 1},
 		{`len(1)`, "No string in arguments"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -356,6 +419,48 @@ func TestBuiltinFunctions(t *testing.T) {
 		}
 	}
 }
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[-1]`, "o"},
+		{`"日本語"[2]`, "語"},
+		{`let s = ""; for (i, c in "añb") { s += to_string(i) + c }; s`, "0a1ñ2b"},
+		{`let größe = 3; let user_id = 4; let x2 = 5; to_string(größe + user_id + x2)`, "12"},
+		{`let _tmp = "ok"; _tmp`, "ok"},
+		{`to_string(1.5) + to_string([1]) + to_string(if (false) { 1 }) + to_string("s")`, "1.5[1,]nulls"},
+		{`"abc"[3]`, fmt.Errorf("index 3 out of range for string of length 3")},
+		{`"abc"["a"]`, fmt.Errorf("string index must be an integer, got STRING")},
+		{`let s = "abc"; s[0] = "x"`, fmt.Errorf("index assignment requires array or object, got STRING")},
+		{`to_string(1, 2)`, fmt.Errorf("wrong number of arguments. got=2, want=1")},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*obj.String)
+			if !ok {
+				t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%q: String has wrong value. expected=%q, got=%q", tt.input, expected, str.Value)
+			}
+		case error:
+			errObj, ok := evaluated.(*obj.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.ErrMsg != expected.Error() {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected.Error(), errObj.ErrMsg)
+			}
+		}
+	}
+}
+
 func TestArrIndex(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -377,3 +482,843 @@ func TestArrIndex(t *testing.T) {
 
 	}
 }
+
+func TestComputedIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; let i = 0; a[i]", 1},
+		{"let a = [1, 2, 3]; let i = 0; a[i + 1]", 2},
+		{"let a = [1, 2, 3]; a[-1]", 3},
+		{"let a = [1, 2, 3]; a[-3]", 1},
+		{"[10, 20][1]", 20},
+		{"let f = fn() { [4, 5, 6] }; f()[2]", 6},
+		{"let a = [[1, 2], [3, 4]]; a[1][0]", 3},
+		{`let o = {{"k": 1}}; let key = "k"; o[key]`, 1},
+		{`let o = {{"k": [7, 8]}}; o["k"][1]`, 8},
+		{`{{1: 10, true: 20}}[1]`, 10},
+		{`{{1: 10, true: 20}}[true]`, 20},
+		{`let o = {{"k": 1}}; o["missing"]`, nil},
+		{"let a = [1, 2, 3]; a[3]", "index 3 out of range for array of length 3"},
+		{"let a = [1, 2, 3]; a[-4]", "index -4 out of range for array of length 3"},
+		{`let a = [1]; a["0"]`, "array index must be an integer, got STRING"},
+		{`let o = {{"k": 1}}; o[[1]]`, "unusable as object key: Array"},
+		{"let x = 5; x[0]", "index operation requires array, object or string, got Integer"},
+		{"let a = [1]; a[b]", "Undefined variable: b"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			if evaluated != NULL {
+				t.Errorf("%q: expected NULL, got=%T(%+v)", tt.input, evaluated, evaluated)
+			}
+		case string:
+			errObj, ok := evaluated.(*obj.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.ErrMsg != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.ErrMsg)
+			}
+		}
+	}
+}
+
+func TestObjectKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let o = {{1: "int", "1": "string"}}; o[1]`, "int"},
+		{`let o = {{1: "int", "1": "string"}}; o["1"]`, "string"},
+		{`let o = {{true: "yes", "true": "string"}}; o[true]`, "yes"},
+		{`let o = {{1: "one"}}; o[1.0]`, "one"},
+		{`let o = {{1.5: "float"}}; o[1.5]`, "float"},
+		{`let k = "name"; let o = {{k: "x"}}; o["name"]`, "x"},
+		{`let o = {{1 + 1: "two"}}; o[2]`, "two"},
+		{`let o = {{}}; o[1] = "a"; o["1"] = "b"; o[1]`, "a"},
+		{`{{fn(x) { x }: 1}}`, "unusable as object key: Function"},
+		{`{{[1]: 1}}`, "unusable as object key: Array"},
+		{`let o = {{}}; o[{{}}] = 1`, "unusable as object key: Object"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch evaluated := evaluated.(type) {
+		case *obj.String:
+			if evaluated.Value != tt.expected {
+				t.Errorf("%q: wrong value. expected=%q, got=%q", tt.input, tt.expected, evaluated.Value)
+			}
+		case *obj.Error:
+			if evaluated.ErrMsg != tt.expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expected, evaluated.ErrMsg)
+			}
+		default:
+			t.Errorf("%q: unexpected result %T(%+v)", tt.input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestObjectLiteralEvaluationOrder(t *testing.T) {
+	input := `let log = "";
+let o = {{"a": log += "1", (log += "2"): log += "3", "c": log += "4"}};
+log`
+	for i := 0; i < 10; i++ {
+		evaluated := testEval(input)
+		str, ok := evaluated.(*obj.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != "1234" {
+			t.Fatalf("entries evaluated out of order. got=%q", str.Value)
+		}
+	}
+	inspected := testEval(`{{"z": 1, "a": 2, "m": 3}}`).Inspect()
+	if inspected != "{z:1,\na:2,\nm:3,\n}" {
+		t.Errorf("wrong Inspect(). got=%q", inspected)
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 == 1", true},
+		{"1 == 1.0", true},
+		{"9223372036854775807 + 1 == 9223372036854775808.0", true},
+		{"9223372036854775807 + 1 == 9223372036854775807 + 1", true},
+		{"0.5 == 0", false},
+		{`"a" == "a"`, true},
+		{`"1" == 1`, false},
+		{"1 == true", false},
+		{"true != 1", true},
+		{"[1, 2, [3]] == [1, 2, [3]]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[1] == [1.0]", true},
+		{`{{"a": 1, "b": [2]}} == {{"b": [2], "a": 1}}`, true},
+		{`{{"a": 1}} == {{"a": 2}}`, false},
+		{`{{"a": 1}} == {{"a": 1, "b": 2}}`, false},
+		{`{{1: "x"}} == {{"1": "x"}}`, false},
+		{"[] == {{}}", false},
+		{"fn(x) { x } == fn(x) { x }", false},
+		{"let f = fn(x) { x }; f == f", true},
+		{"let f = fn(x) { x }; let g = f; [f] == [g]", true},
+		{"len == len", true},
+		{"len == print", false},
+		{"if (false) { 1 } == if (false) { 2 }", true},
+		{"let a = [1]; let b = a; a[0] = 2; a == b", true},
+		//values that hold themselves
+		{"let a = [1]; a[0] = a; a == a", true},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b", true},
+		{"let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a == b", false},
+		{"let a = [1]; a[0] = a; let b = [a]; a == b", true},
+		{`let o = {{"k": 1}}; o["self"] = o; o == o`, true},
+		{`let o = {{"k": 1}}; o["self"] = o; let p = {{"k": 1}}; p["self"] = p; o == p`, true},
+		{`let o = {{"k": 1}}; o["self"] = o; let p = {{"k": 2}}; p["self"] = p; o == p`, false},
+		{`let a = [0]; let o = {{"a": a}}; a[0] = o; [o] == [o]`, true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if _, ok := evaluated.(*obj.Boolean); !ok {
+			t.Errorf("%q: object is not Boolean. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2]; a[0] = a; to_string(a)", "[[...],2,]"},
+		{`let o = {{"k": 1}}; o["self"] = o; to_string(o)`, "{k:1,\nself:{...},\n}"},
+		{`let a = [0]; let o = {{"a": a}}; a[0] = o; to_string(a)`, "[{a:[...],\n},]"},
+		{"let b = [1]; let a = [b, b]; to_string(a)", "[[1,],[1,],]"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*obj.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: wrong text. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestTruthiness(t *testing.T) {
+	tests := []struct {
+		value  string
+		truthy bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"if (false) { 1 }", false}, //null
+		{"1", true},
+		{"-1", true},
+		{"0", false},
+		{"9223372036854775807 + 1", true},
+		{"0.5", true},
+		{"0.0", false},
+		{`"a"`, true},
+		{`" "`, true},
+		{`""`, false},
+		{"[0]", true},
+		{"[]", false},
+		{`{{"a": 0}}`, true},
+		{"{{}}", false},
+		{"fn() { false }", true},
+		{"len", true},
+	}
+	for _, tt := range tests {
+		//Every construct that tests a condition has to agree.
+		checks := []struct {
+			input    string
+			expected bool
+		}{
+			{"if (" + tt.value + ") { true } else { false }", tt.truthy},
+			{"!(" + tt.value + ")", !tt.truthy},
+			{"(" + tt.value + ") && true", tt.truthy},
+			{"(" + tt.value + ") || false", tt.truthy},
+			{"let n = 0; let v = " + tt.value + "; for (v) { n += 1; v = false }; n == 1", tt.truthy},
+		}
+		for _, check := range checks {
+			evaluated := testEval(check.input)
+			if _, ok := evaluated.(*obj.Boolean); !ok {
+				t.Errorf("%q: object is not Boolean. got=%T (%+v)", check.input, evaluated, evaluated)
+				continue
+			}
+			if evaluated.(*obj.Boolean).Value != check.expected {
+				t.Errorf("%q: expected %t, got %t", check.input, check.expected, !check.expected)
+			}
+		}
+	}
+
+	if err, ok := testEval("for (x) { 1 }").(*obj.Error); !ok || err.ErrMsg != "Undefined variable: x" {
+		t.Errorf("error in for condition was not returned. got=%v", testEval("for (x) { 1 }"))
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"match (2) { 1 => 10, 2 => 20, _ => 30 }", 20},
+		{"match (5) { 1 => 10, 2 => 20, _ => 30 }", 30},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{"match (2.0) { 2 => 1, _ => 0 }", 1},
+		{"match (1 + 1) { x => x * 10 }", 20},
+		{"let y = 1; match (2) { y => y }; y", 1},
+		{"match (7) { n if n < 5 => 1, n if n < 10 => 2, _ => 3 }", 2},
+		{"match (3) { n if n < 5 => { let m = n * 2; m + 1 } _ => 0 }", 7},
+		{"match ([1, 2]) { [a] => a, [a, b] => a + b, _ => 0 }", 3},
+		{"match ([1, [2, 3]]) { [1, [_, c]] => c }", 3},
+		{"match ([1, 2]) { [2, x] => x, [1, x] => x * 100 }", 200},
+		{`match ({{"kind": "circle", "r": 2}}) { {{"kind": "square", "side": s}} => s, {{"kind": "circle", "r": r}} => r * 3 }`, 6},
+		{`match ({{"a": 1}}) { {{"b": x}} => x, _ => 0 }`, 0},
+		{"match ([]) { {{}} => 1, [] => 2 }", 2},
+		{"let f = fn(x) { match (x) { 0 => { return 100 } _ => 1 }; 200 }; f(0)", 100},
+		{"let t = -1; match (-1) { -1 => 1, _ => 0 }", 1},
+		{"match (1) { 1 => { 2 }}", 2},
+		{"match (1) { 0 => { 1 } _ => { match (2) { 2 => { 3 }}}}", 3},
+		{"match (4) { 1 => 10 }", "no match arm matches 4"},
+		{"match (4) { n if n > 10 => 10 }", "no match arm matches 4"},
+		{"match (x) { _ => 1 }", "Undefined variable: x"},
+		{"match (1) { n if m => 1 }", "Undefined variable: m"},
+		{"_", "_ can only be used as a pattern in match"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*obj.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.ErrMsg != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.ErrMsg)
+			}
+		}
+	}
+}
+
+func TestLoopControl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; for (true) { i++; if (i == 5) { break } }; i", 5},
+		{"let i = 0; let sum = 0; for (i < 10) { i++; if (i % 2 == 0) { continue }; sum += i }; sum", 25},
+		{"let i = 0; for (i < 3) { i++; i * 10 }", 30},
+		{"let i = 0; for (i < 3) { i++; if (i == 2) { break }; i * 10 }", 10},
+		{"for (false) { 1 }", nil},
+		{"let i = 0; let n = 0; for (i < 3) { i++; let j = 0; for (true) { j++; if (j > i) { break }; n++ } }; n", 6},
+		{"let i = 0; for (true) { i++; let stop = if (i == 4) { break }; }; i", 4},
+		{"let i = 0; for (true) { i++; match (i) { 3 => { break } _ => { continue } } }; i", 3},
+		{"let f = fn() { let i = 0; for (true) { i++; if (i == 3) { return i * 100 } }; 99 }; f()", 300},
+		{"let f = fn() { for (true) { return 1 }; 2 }; f() + 10", 11},
+		{"let i = 0; for (true) { i++; if (i == 3) { x } }; i", "Undefined variable: x"},
+		//an if used as a value passes break and continue on to the loop
+		{"let j = 0; let f = fn(x) { x }; for (true) { j++; f(if (j == 2) { break } else { j }); if (j > 4) { break } }; j", 2},
+		{"let k = 0; let a = [0]; for (true) { k++; a = [if (k == 2) { break } else { k }]; if (k > 4) { break } }; k * 10 + a[0]", 21},
+		{"let x = 0; let i = 0; for (i < 5) { i++; x = if (i == 3) { break } else { i } }; x", 2},
+		{"let x = [0]; let i = 0; for (i < 5) { i++; x[0] += if (i == 3) { break } else { i } }; x[0]", 3},
+		{"let i = 0; for (true) { i++; 1 + if (i == 3) { break } else { 0 } }; i", 3},
+		{"let i = 0; for (true) { i++; -if (i == 3) { break } else { i } }; i", 3},
+		{`let s = 0; for (x in [1, 2, 3]) { let o = {{"v": if (x == 2) { continue } else { x }}}; s += o["v"] }; s`, 4},
+		{`let s = ""; for (x in [1, 2, 3]) { s += "${if (x == 2) { continue } else { x }}" }; len(s)`, 2},
+		{"let f = fn() { for (true) { return if (true) { break } }; 7 }; f()", 7},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*obj.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.ErrMsg != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.ErrMsg)
+			}
+		}
+	}
+
+	//The parser does not let break out of a loop, but trees built by hand can still have one.
+	program := &ast.Program{Statements: []ast.Statement{&ast.BreakStatement{}}}
+	evaluated := Eval(program, obj.NewEnvironment())
+	if err, ok := evaluated.(*obj.Error); !ok || err.ErrMsg != "break outside of a loop" {
+		t.Errorf("break at the top level was not an error. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (let i = 0; i < 5; i++) { sum += i }; sum", 10},
+		{"let s = 0; for (x in [1, 2]) { if (true) { s += x }}; s", 3},
+		{"let s = 0; for (let i = 0; i < 3; i++) { if (i > 0) { s += i } else { s += 10 }}; s", 13},
+		{"let i = 0; for (i < 3) { i++; if (i == 1) { i += 5 }}; i", 6},
+		{"let sum = 0; for (let i = 10; i > 0; i -= 3) { sum += i }; sum", 22},
+		{"let i = 0; for (; i < 4;) { i++ }; i", 4},
+		{"let i = 100; for (let i = 0; i < 3; i++) { i }; i", 100},
+		{"let i = 100; for (i = 0; i < 3; i++) { i }; i", 3},
+		{"let n = 0; for (;;) { n++; if (n == 7) { break } }; n", 7},
+		{"let s = 0; for (let i = 0; i < 10; i++) { if (i % 3 != 0) { continue }; s += i }; s", 18},
+		{"let fns = [0, 0, 0]; for (let i = 0; i < 3; i++) { fns[i] = fn() { i } }; fns[0]() + fns[1]() * 10 + fns[2]() * 100", 210},
+		{"let n = 0; for (let i = 0; i < 10; i++) { i += 1; n++ }; n", 5},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum += i * x }; sum", 80},
+		{`let keys = ""; for (k in {{"a": 1, "b": 2, "c": 3}}) { keys += k }; keys`, "abc"},
+		{`let sum = 0; for (k, v in {{"a": 1, "b": 2}}) { sum += v }; sum`, 3},
+		{`let out = ""; for (c in "héllo") { out = c + out }; out`, "olléh"},
+		{`let last = 0; for (i, c in "héllo") { last = i }; last`, 4},
+		{"let sum = 0; for (n in range(5)) { sum += n }; sum", 10},
+		{"let sum = 0; for (n in range(2, 5)) { sum += n }; sum", 9},
+		{"let sum = 0; for (n in range(10, 0, -3)) { sum += n }; sum", 22},
+		{"let sum = 0; for (i, n in range(5, 8)) { sum += i }; sum", 3},
+		{"let n = 0; for (x in range(0)) { n++ }; n", 0},
+		{"let fns = [0, 0]; for (i in range(2)) { fns[i] = fn() { i } }; fns[0]() + fns[1]() * 10", 10},
+		{"let x = 5; for (x in [1, 2]) { x }; x", 5},
+		{"for (x in [1, 2, 3]) { x * 10 }", 30},
+		{"for (x in []) { x }", nil},
+		{"let f = fn() { for (x in range(100)) { if (x == 42) { return x } } }; f()", 42},
+		{"for (x in 5) { x }", "cannot iterate over Integer"},
+		{"range(1, 2, 0)", "range step must not be zero"},
+		{`range("a")`, "range arguments must be integers, got STRING"},
+		{"for (let i = 0; i < 3; j++) { i }", "cannot assign to undeclared variable: j"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *obj.String:
+				if evaluated.Value != expected {
+					t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, evaluated.Value)
+				}
+			case *obj.Error:
+				if evaluated.ErrMsg != expected {
+					t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, evaluated.ErrMsg)
+				}
+			default:
+				t.Errorf("%q: unexpected result %T(%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestErrorDiagnostic(t *testing.T) {
+	input := `let a = 5;
+a + true;`
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*obj.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	d := errObj.Diagnostic()
+	if d.Code != diag.RuntimeError {
+		t.Errorf("wrong code. expected=%s, got=%s", diag.RuntimeError, d.Code)
+	}
+	if d.Span.Start.Line != 2 || d.Span.Start.Column != 1 {
+		t.Errorf("wrong position. expected 2:1, got=%s", d.Span.Start)
+	}
+}
+
+func TestErrorTraceback(t *testing.T) {
+	input := `let outer = fn(x) {
+	let inner = fn(y) { y + z };
+	inner(x)
+};
+outer(1)`
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*obj.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.ErrMsg != "Undefined variable: z" {
+		t.Errorf("wrong error message. got=%q", errObj.ErrMsg)
+	}
+	expected := []struct {
+		name   string
+		line   int
+		column int
+	}{
+		{"outer", 5, 1},
+		{"inner", 3, 2},
+	}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack depth. expected=%d, got=%d (%+v)", len(expected), len(errObj.Stack), errObj.Stack)
+	}
+	for i, frame := range expected {
+		got := errObj.Stack[i]
+		if got.Name != frame.name || got.Pos.Line != frame.line || got.Pos.Column != frame.column {
+			t.Errorf("frame[%d]: expected %s at %d:%d, got %s at %d:%d", i, frame.name, frame.line, frame.column, got.Name, got.Pos.Line, got.Pos.Column)
+		}
+	}
+	traceback := `Traceback (most recent call last):
+  File "<input>", line 5, column 1, in <main>
+  File "<input>", line 3, column 2, in outer
+  File "<input>", line 2, column 26, in inner
+`
+	if errObj.Traceback() != traceback {
+		t.Errorf("wrong traceback. expected=\n%s\ngot=\n%s", traceback, errObj.Traceback())
+	}
+
+	evaluated = testEval("fn(x) { x }(1, 2)")
+	errObj, ok = evaluated.(*obj.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.ErrMsg != "wrong number of arguments. got=2, want=1" {
+		t.Errorf("wrong error message. got=%q", errObj.ErrMsg)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.25", -2.25},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"2 * 1.25 - 1", 1.5},
+		{"-(1.5 * 2)", -3},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*obj.Float)
+		if !ok {
+			t.Errorf("%q: object is not Float. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if result.Value != tt.expected {
+			t.Errorf("%q: object has wrong value. got=%v, want=%v", tt.input, result.Value, tt.expected)
+		}
+	}
+
+	comparisons := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1.0 == 1", true},
+		{"1 != 1.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+		//integers and floats are compared exactly, even where the integer does not fit in a float
+		{"let a = 9223372036854775807; let b = 9223372036854775808.0; a == b", false},
+		{"let a = 9223372036854775807; let b = 9223372036854775808.0; a < b", true},
+		{"let a = 9223372036854775807; let b = 9223372036854775808.0; a > b", false},
+		{"let a = 9223372036854775807; let b = 9223372036854775808.0; a <= b", true},
+		{"let a = 9223372036854775807; let b = 9223372036854775808.0; a >= b", false},
+		{"let a = 9223372036854775807; let b = 9223372036854775808.0; b > a", true},
+		{"9007199254740993 > 9007199254740992.0", true},
+		{"9223372036854775807 + 1 >= 9223372036854775808.0", true},
+		{"9223372036854775807 + 2 > 9223372036854775808.0", true},
+		{"(1 << 1100) < 1e308 * 10", true},
+		{"-(1 << 1100) > -1e308 * 10", true},
+		{"let inf = 1e308 * 10; let nan = inf - inf; 1 < nan", false},
+		{"let inf = 1e308 * 10; let nan = inf - inf; 1 >= nan", false},
+	}
+	for _, tt := range comparisons {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testIntegerObject(t, testEval("7 / 2"), 3)
+	if got := testEval("2.0").Inspect(); got != "2.0" {
+		t.Errorf("wrong Inspect() for 2.0. got=%q", got)
+	}
+}
+
+func TestIntegerOverflowPromotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		big      bool
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", true},
+		{"-9223372036854775807 - 2", "-9223372036854775809", true},
+		{"4294967296 * 4294967296", "18446744073709551616", true},
+		{"3037000500 * 3037000500", "9223372037000250000", true},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808", true},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808", true},
+		{"let a = 9223372036854775807 * 10; a * a", "8507059173023461584739690778423250124900", true},
+		{"9223372036854775807 + 1 - 1", "9223372036854775807", false},
+		{"(9223372036854775807 * 4) / 4", "9223372036854775807", false},
+		{"-(9223372036854775807 + 1)", "-9223372036854775808", false},
+		{"9223372036854775807 * 1", "9223372036854775807", false},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.DataType() != obj.INTEGER_OBJ {
+			t.Errorf("%q: object is not an integer. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if _, isBig := evaluated.(*obj.BigInteger); isBig != tt.big {
+			t.Errorf("%q: wrong representation. expected big=%t, got=%T", tt.input, tt.big, evaluated)
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong value. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	comparisons := []struct {
+		input    string
+		expected bool
+	}{
+		{"9223372036854775807 + 1 > 9223372036854775807", true},
+		{"9223372036854775807 + 1 < 1", false},
+		{"9223372036854775807 + 1 == 9223372036854775807 + 1", true},
+		{"9223372036854775807 + 2 != 9223372036854775807 + 1", true},
+		{"9223372036854775807 + 1 - 1 == 9223372036854775807", true},
+		{"9223372036854775807 * 2 > 1.5", true},
+	}
+	for _, tt := range comparisons {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0xF0 | 0x0F", "255"},
+		{"0xFF & 0x0F", "15"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"~-1", "0"},
+		{"-6 & 0xFF", "250"},
+		{"1 << 4", "16"},
+		{"-8 >> 1", "-4"},
+		{"-1 >> 100", "-1"},
+		{"5 >> 64", "0"},
+		{"1 << 63", "9223372036854775808"},
+		{"3 << 62", "13835058055282163712"},
+		{"-1 << 63", "-9223372036854775808"},
+		{"(1 << 70) >> 69", "2"},
+		{"(1 << 70) | 1", "1180591620717411303425"},
+		{"((1 << 70) | 5) & 7", "5"},
+		{"(1 << 64) ^ (1 << 64)", "0"},
+		{"~(1 << 64)", "-18446744073709551617"},
+		{"-(1 << 70) >> 5000000", "-1"},
+		{"(1 << 70) >> (1 << 70)", "0"},
+		{"1 | 2 ^ 3 & 4", "3"},
+		{"1 + 2 << 1", "6"},
+		{"let flags = 0; flags = flags | 0b100; (flags & 0b100) != 0", true},
+		{"1 << -1", fmt.Errorf("negative shift count: -1")},
+		{"(1 << 70) << -1", fmt.Errorf("negative shift count: -1")},
+		{"1 << (1 << 21)", fmt.Errorf("shift count too large: 2097152")},
+		{"1.5 & 1", fmt.Errorf("unknown operator: Float & Integer")},
+		{"~1.5", fmt.Errorf("unknown operator: ~Float")},
+		{"true | false", fmt.Errorf("unknown operator: Bool | Bool")},
+		{"1 | 2 == 3", fmt.Errorf("type mismatch: Integer | Bool")},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.DataType() != obj.INTEGER_OBJ {
+				t.Errorf("%q: object is not an integer. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q: wrong value. expected=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case error:
+			errObj, ok := evaluated.(*obj.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.ErrMsg != expected.Error() {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected.Error(), errObj.ErrMsg)
+			}
+		}
+	}
+}
+
+func TestDivisionAndModulo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"-7 % -3", -1},
+		{"-7 / 2", -3},
+		{"(-7 / 3) * 3 + -7 % 3", -7},
+		{"(9223372036854775807 + 10) % 10", 7},
+		{"1 + 10 % 4 * 2", 5},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("7.5 % 2")
+	if f, ok := evaluated.(*obj.Float); !ok || f.Value != 1.5 {
+		t.Errorf("7.5 %% 2: expected Float 1.5, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	errors := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "modulo by zero"},
+		{"1.5 / 0", "division by zero"},
+		{"1 % 0.0", "modulo by zero"},
+		{"(9223372036854775807 + 1) / 0", "division by zero"},
+		{"(9223372036854775807 + 1) % (1 - 1)", "modulo by zero"},
+		{"let f = fn(x) { 10 / x }; f(0); 5", "division by zero"},
+	}
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*obj.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.ErrMsg != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.ErrMsg)
+		}
+	}
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"false && undefinedVariable", false},
+		{"true || undefinedVariable", true},
+		{"false && 1 / 0", false},
+		{"let a = 5; a > 0 && a < 10", true},
+		{"let called = fn() { undefinedVariable }; false && called()", false},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("true && undefinedVariable")
+	errObj, ok := evaluated.(*obj.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.ErrMsg != "Undefined variable: undefinedVariable" {
+		t.Errorf("wrong error message. got=%q", errObj.ErrMsg)
+	}
+}
+
+func TestClosuresAndScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 10; let f = fn() { x }; f()", 10},
+		{"let x = 10; let f = fn() { fn() { x + 1 } }; f()()", 11},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3)", 5},
+		{"let make = fn() { let secret = 42; fn() { secret } }; let get = make(); let secret = 1; get()", 42},
+		{"let x = 1; let f = fn(x) { x * 10 }; f(2) + x", 21},
+		{"let x = 1; let f = fn() { let x = 5; x }; f() + x", 6},
+		{"let i = 0; let current = fn() { i }; for (i < 3) { let i = i + 1 }; current()", 3},
+		{"let twice = fn(f, x) { f(f(x)) }; let inc = fn(x) { x + 1 }; twice(inc, 5)", 7},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("let f = fn() { let local = 1; local }; f(); local")
+	errObj, ok := evaluated.(*obj.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.ErrMsg != "Undefined variable: local" {
+		t.Errorf("wrong error message. got=%q", errObj.ErrMsg)
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let a = 0; let b = 0; a = b = 7; a + b", 14},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 4; x", 2},
+		{"let x = 10; x /= 4.0; x", 2.5},
+		{"let s = \"foo\"; s += \"bar\"; s", "foobar"},
+		{"let x = 1; x++", 1},
+		{"let x = 1; x++; x", 2},
+		{"let x = 1; x--; x", 0},
+		{"let x = 1.5; x++; x", 2.5},
+		{"let i = 0; let sum = 0; for (i < 5) { sum += i; i++ }; sum", 10},
+		{"let count = 0; let inc = fn() { count += 1 }; inc(); inc(); count", 2},
+		{"let x = 1; let f = fn(x) { x = 100; x }; f(5) + x", 101},
+		{"let makeCounter = fn() { let n = 0; fn() { n++; n } }; let c = makeCounter(); c(); c(); c()", 3},
+		{"let a = makeCounter = 1", "cannot assign to undeclared variable: makeCounter"},
+		{"y = 1", "cannot assign to undeclared variable: y"},
+		{"y += 1", "cannot assign to undeclared variable: y"},
+		{"y++", "cannot assign to undeclared variable: y"},
+		{"y--", "cannot assign to undeclared variable: y"},
+		{"let s = \"a\"; s++", "unknown operator: STRING++"},
+		{"let x = 1; x += true", "type mismatch: Integer + Bool"},
+		{"let x = 1; x /= 0", "division by zero"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			if f, ok := evaluated.(*obj.Float); !ok || f.Value != expected {
+				t.Errorf("%q: expected float %v, got=%T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		case string:
+			if str, ok := evaluated.(*obj.String); ok {
+				if str.Value != expected {
+					t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, str.Value)
+				}
+				continue
+			}
+			errObj, ok := evaluated.(*obj.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.ErrMsg != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.ErrMsg)
+			}
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 5; a[0]", 5},
+		{"let a = [1, 2, 3]; a[2] = 5", 5},
+		{"let a = [1, 2, 3]; let i = 1; a[i + 1] = 7; a[2]", 7},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a[0]", 9},
+		{"let a = [1, 2]; a[1] += 5; a[1]", 7},
+		{"let a = [1, 2]; a[0]++; a[0]", 2},
+		{`let cfg = {{"port": 80}}; cfg["port"] = 8080; cfg["port"]`, 8080},
+		{`let cfg = {{"port": 80}}; cfg["host"] = "localhost"; cfg["host"]`, "localhost"},
+		{`let a = [0, {{"k": 1}}]; a[1]["k"] = 2; a[1]["k"]`, 2},
+		{`let a = [[1, 2], [3, 4]]; a[1][0] = 30; a[1][0]`, 30},
+		{"let a = [1]; a[1] = 2", "index 1 out of range for array of length 1"},
+		{"let a = [1, 2]; a[-1] = 5; a[1]", 5},
+		{"let a = [1]; a[-2] = 2", "index -2 out of range for array of length 1"},
+		{`let a = [1]; a["k"] = 2`, "array index must be an integer, got STRING"},
+		{"let x = 5; x[0] = 1", "index assignment requires array or object, got Integer"},
+		{"b[0] = 1", "Undefined variable: b"},
+		//the container and the index of a compound target are evaluated once
+		{"let n = 0; let f = fn() { n += 1; n - 1 }; let a = [10, 20, 30]; a[f()] += 1; if (a == [11, 20, 30]) { n } else { -1 }", 1},
+		{"let n = 0; let f = fn() { n += 1; n - 1 }; let a = [10, 20, 30]; a[f()]++; if (a == [11, 20, 30]) { n } else { -1 }", 1},
+		{"let n = 0; let f = fn() { n += 1; n - 1 }; let a = [10, 20, 30]; a[f()]--", 10},
+		{"let n = 0; let f = fn() { n += 1; [7] }; f()[0] *= 2; n", 1},
+		{`let n = 0; let k = fn() { n += 1; "k" + to_string(n) }; let o = {{"k1": 5}}; o[k()] += 1; if (o == {{"k1": 6}}) { n } else { -1 }`, 1},
+		{`let a = ["x"]; a[0]++`, "unknown operator: STRING++"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if str, ok := evaluated.(*obj.String); ok {
+				if str.Value != expected {
+					t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, str.Value)
+				}
+				continue
+			}
+			errObj, ok := evaluated.(*obj.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.ErrMsg != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.ErrMsg)
+			}
+		}
+	}
+}
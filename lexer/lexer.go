@@ -1,23 +1,42 @@
 package lexer
 
 import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Revolyssup/monkey/diag"
 	token "github.com/Revolyssup/monkey/token"
 )
 
 type Lexer struct {
 	input    string
+	file     string
 	lastRead int
 	readPos  int
-	ch       byte
+	ch       rune
+	//line and column of ch
+	line   int
+	col    int
+	errors []diag.Diagnostic
+	//The {, {{ and ${ (as STRING_HEAD) that are still open, innermost last.
+	//It tells which } ends the interpolation, and whether a }} is one token or two braces.
+	braces []token.TokenType
 }
 
 func (l *Lexer) NextToken() token.Token {
+	l.skipWhitespaceAndComments()
+	start := l.position()
+	tok := l.scan()
+	tok.Pos = start
+	tok.End = l.position()
+	return tok
+}
+
+//scan reads the token starting at the current character and leaves the lexer just past it.
+func (l *Lexer) scan() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
-	if l.ch == '#' {
-		l.skipComment()
-		l.skipWhitespace()
-	}
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -26,11 +45,21 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.Token{Type: token.EQUAL, Literal: string(firstchar) + string(l.ch)}
 			break
 		}
+		if l.peekChar() == '>' {
+			l.read()
+			tok = token.Token{Type: token.FAT_ARROW, Literal: "=>"}
+			break
+		}
 		tok = newToken(token.ASSIGN, l.ch)
 	case '+':
 		if l.peekChar() == '+' {
 			l.read()
-			tok = newToken(token.INCREMENT, l.ch)
+			tok = token.Token{Type: token.INCREMENT, Literal: "++"}
+			break
+		}
+		if l.peekChar() == '=' {
+			l.read()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
 			break
 		}
 		tok = newToken(token.PLUS, l.ch)
@@ -46,10 +75,28 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '{' {
 			l.read()
 			tok = newToken(token.LEFT_OBJECT_BRACE, l.ch)
-			break
+		} else {
+			tok = newToken(token.LEFT_BRACE, l.ch)
 		}
-		tok = newToken(token.LEFT_BRACE, l.ch)
+		l.braces = append(l.braces, tok.Type)
 	case '}':
+		//}} closes an object only when the innermost open brace is {{, so blocks can end together as in { if (x) { 1 }}
+		if n := len(l.braces); n > 0 {
+			open := l.braces[n-1]
+			if open == token.STRING_HEAD {
+				//the string goes on after the }
+				l.braces = l.braces[:n-1]
+				tok.Literal, tok.Type = l.readString(true)
+				break
+			}
+			if open == token.LEFT_BRACE || l.peekChar() == '}' {
+				l.braces = l.braces[:n-1]
+			}
+			if open == token.LEFT_BRACE {
+				tok = newToken(token.RIGHT_BRACE, l.ch)
+				break
+			}
+		}
 		if l.peekChar() == '}' {
 			l.read()
 			tok = newToken(token.RIGHT_OBJECT_BRACE, l.ch)
@@ -59,14 +106,31 @@ func (l *Lexer) NextToken() token.Token {
 	case '-':
 		if l.peekChar() == '-' {
 			l.read()
-			tok = newToken(token.DECREMENT, l.ch)
+			tok = token.Token{Type: token.DECREMENT, Literal: "--"}
+			break
+		}
+		if l.peekChar() == '=' {
+			l.read()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
 			break
 		}
 		tok = newToken(token.MINUS, l.ch)
 	case '*':
+		if l.peekChar() == '=' {
+			l.read()
+			tok = token.Token{Type: token.ASTERIK_ASSIGN, Literal: "*="}
+			break
+		}
 		tok = newToken(token.ASTERIK, l.ch)
 	case '/':
+		if l.peekChar() == '=' {
+			l.read()
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+			break
+		}
 		tok = newToken(token.SLASH, l.ch)
+	case '%':
+		tok = newToken(token.MODULO, l.ch)
 	case '!':
 		if l.peekChar() == '=' {
 			firstchar := l.ch
@@ -76,12 +140,52 @@ func (l *Lexer) NextToken() token.Token {
 		}
 		tok = newToken(token.BANG, l.ch)
 	case '<':
+		if l.peekChar() == '<' {
+			l.read()
+			tok = token.Token{Type: token.SHIFT_LEFT, Literal: "<<"}
+			break
+		}
+		if l.peekChar() == '=' {
+			l.read()
+			tok = token.Token{Type: token.LESS_EQUAL, Literal: "<="}
+			break
+		}
 		tok = newToken(token.LESS_THAN, l.ch)
 	case '>':
+		if l.peekChar() == '>' {
+			l.read()
+			tok = token.Token{Type: token.SHIFT_RIGHT, Literal: ">>"}
+			break
+		}
+		if l.peekChar() == '=' {
+			l.read()
+			tok = token.Token{Type: token.GRTR_EQUAL, Literal: ">="}
+			break
+		}
 		tok = newToken(token.GRTR_THAN, '>')
+	case '&':
+		if l.peekChar() == '&' {
+			l.read()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+			break
+		}
+		tok = newToken(token.BIT_AND, l.ch)
+	case '|':
+		if l.peekChar() == '|' {
+			l.read()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+			break
+		}
+		tok = newToken(token.BIT_OR, l.ch)
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
 	case '"':
+		tok.Literal, tok.Type = l.readString(false)
+	case '`':
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = l.readRawString()
 	case '[':
 		tok = newToken(token.LEFT_LARGE_BRACKET, '[')
 	case ']':
@@ -92,13 +196,12 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default: //handling identifiers
-		if l.isLetter(l.ch) {
+		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.IdentOrKeyword(tok.Literal) //check if the given literal exists on keyword map
 			return tok
-		} else if l.isNumber(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INTEGER
+		} else if isNumber(l.ch) {
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
 
@@ -111,82 +214,315 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+//NewFile is like New, but every token position will also carry the given file name.
+func NewFile(file string, input string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.read()
 	return l
 }
 
 //utilities
 
+//read moves to the next character. The input is decoded as UTF-8, and bytes that are not valid UTF-8 are reported and read as U+FFFD.
 func (l *Lexer) read() {
+	if l.readPos > len(l.input) { //already sitting at the end, nothing more to read
+		return
+	}
+	if l.ch == '\n' {
+		l.line++
+		l.col = 0
+	}
+	l.col++
+	width := 1
 	if l.readPos >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPos]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPos:])
 	}
 	l.lastRead = l.readPos
-	l.readPos += 1
+	l.readPos += width
+	if l.ch == utf8.RuneError && width == 1 {
+		l.errorAt(token.Span{Start: l.position(), End: l.endPosition()}, diag.InvalidUTF8, "invalid UTF-8 byte %#x", l.input[l.lastRead])
+	}
 }
 
+//Identifiers start with a letter or _, and can go on with digits too.
 func (l *Lexer) readIdentifier() string {
 	pos := l.lastRead
-	for l.isLetter(l.ch) {
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.read()
 	}
 	return l.input[pos:l.lastRead]
 }
 
-func (l *Lexer) readNumber() string {
+//readNumber reads a number literal: an integer in decimal, or in hex, octal or binary after 0x, 0o or 0b, or a decimal float
+//with a fraction, an exponent or both. Digits can be grouped with _. Checking the digits is left to the parser.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	pos := l.lastRead
-	for l.isNumber(l.ch) {
+	tt := token.TokenType(token.INTEGER)
+	if l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar()) {
+		l.read()
+		l.read()
+		//letters are taken in too, so that 0xFG or 0b12 is one bad literal instead of a number followed by something else
+		for isLetter(l.ch) || unicode.IsDigit(l.ch) {
+			l.read()
+		}
+		return l.input[pos:l.lastRead], tt
+	}
+	l.readDigits()
+	if l.ch == '.' && isNumber(l.peekChar()) {
+		tt = token.FLOAT
 		l.read()
+		l.readDigits()
 	}
-	return l.input[pos:l.lastRead]
+	if (l.ch == 'e' || l.ch == 'E') && l.exponentFollows() {
+		tt = token.FLOAT
+		l.read()
+		if l.ch == '+' || l.ch == '-' {
+			l.read()
+		}
+		l.readDigits()
+	}
+	return l.input[pos:l.lastRead], tt
 }
-func (l *Lexer) readString() string {
-	start := l.readPos
+
+func (l *Lexer) readDigits() {
+	for isNumber(l.ch) || l.ch == '_' {
+		l.read()
+	}
+}
+
+//exponentFollows reports whether the e in l.ch starts an exponent, i.e. is followed by digits with an optional sign.
+func (l *Lexer) exponentFollows() bool {
+	rest := l.input[l.readPos:]
+	if rest != "" && (rest[0] == '+' || rest[0] == '-') {
+		rest = rest[1:]
+	}
+	return rest != "" && '0' <= rest[0] && rest[0] <= '9'
+}
+
+//readString reads a "..." string, starting with l.ch at the opening quote, and returns its value with the escapes decoded.
+//A ${ ends the token early, as the head of an interpolated string. resumed is set when reading on from the } that closed one.
+func (l *Lexer) readString(resumed bool) (string, token.TokenType) {
+	start := l.position()
+	var out strings.Builder
 	for {
 		l.read()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch l.ch {
+		case '"':
+			if resumed {
+				return out.String(), token.STRING_END
+			}
+			return out.String(), token.STRING
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				break
+			}
+			l.read()
+			l.braces = append(l.braces, token.STRING_HEAD)
+			if resumed {
+				return out.String(), token.STRING_MIDDLE
+			}
+			return out.String(), token.STRING_HEAD
+		case 0:
+			l.errorAt(token.Span{Start: start, End: l.position()}, diag.UnterminatedString, "unterminated string").Hint = "add a closing \""
+			if resumed {
+				return out.String(), token.STRING_END
+			}
+			return out.String(), token.STRING
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+//readEscape decodes the escape sequence starting at the backslash in l.ch, and leaves l.ch at its last character.
+//	\n \t \r \" \\ \$ and \u{hex digits} for any unicode code point
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.position()
+	l.read()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case '$':
+		out.WriteByte('$')
+	case 'u':
+		l.readUnicodeEscape(start, out)
+	case 0: //left for readString to report
+	default:
+		l.errorAt(token.Span{Start: start, End: l.endPosition()}, diag.InvalidEscape, "unknown escape sequence \\%c", l.ch).Hint = `use \\ for a backslash`
+		out.WriteByte('\\')
+		out.WriteRune(l.ch)
+	}
+}
+
+//Enters with l.ch at the u of \u{...}.
+func (l *Lexer) readUnicodeEscape(start token.Position, out *strings.Builder) {
+	digits := ""
+	if l.peekChar() == '{' {
+		l.read()
+		for isHexDigit(l.peekChar()) && len(digits) < 6 {
+			l.read()
+			digits += string(l.ch)
+		}
+	}
+	if digits == "" || l.peekChar() != '}' {
+		l.errorAt(token.Span{Start: start, End: l.endPosition()}, diag.InvalidEscape, "invalid unicode escape").Hint = `write it like \u{e9}, with 1 to 6 hex digits`
+		return
+	}
+	l.read()
+	code, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(code)) {
+		l.errorAt(token.Span{Start: start, End: l.endPosition()}, diag.InvalidEscape, "invalid unicode code point %s", digits)
+		return
+	}
+	out.WriteRune(rune(code))
+}
+
+//readRawString reads a `...` string. Nothing is escaped in it, and it can span lines.
+func (l *Lexer) readRawString() string {
+	start := l.position()
+	for {
+		l.read()
+		if l.ch == '`' {
+			return l.input[start.Offset+1 : l.lastRead]
+		}
+		if l.ch == 0 {
+			l.errorAt(token.Span{Start: start, End: l.position()}, diag.UnterminatedString, "unterminated raw string").Hint = "add a closing `"
+			return l.input[start.Offset+1:]
 		}
 	}
-	return l.input[start:l.lastRead]
 }
-func newToken(tt token.TokenType, ch byte) token.Token {
+
+//Errors returns the problems found while reading the tokens so far.
+func (l *Lexer) Errors() []diag.Diagnostic {
+	return l.errors
+}
+
+func (l *Lexer) errorAt(span token.Span, code string, format string, args ...interface{}) *diag.Diagnostic {
+	l.errors = append(l.errors, diag.Errorf(span, code, format, args...))
+	return &l.errors[len(l.errors)-1]
+}
+func newToken(tt token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tt, Literal: string(ch)}
 }
 
-//currently only supporiting ASCII
-func (l *Lexer) isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+//Letters of any script count, so names like größe or 名前 are fine.
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
-func (l *Lexer) isNumber(ch byte) bool {
+
+//Number literals are written with ASCII digits only.
+func isNumber(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
+func isHexDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.read()
 	}
 }
 
-func (l *Lexer) skipComment() {
+//skipWhitespaceAndComments skips everything up to the next token, however many comments come one after another.
+//	// up to the end of the line
+//	/* up to the matching */, and they nest
+//	# up to the next #, the old style
+//	#! on the first line, a shebang, up to the end of the line
+func (l *Lexer) skipWhitespaceAndComments() {
+	for {
+		l.skipWhitespace()
+		switch {
+		case l.ch == '/' && l.peekChar() == '/':
+			l.skipLine()
+		case l.ch == '/' && l.peekChar() == '*':
+			l.skipBlockComment()
+		case l.ch == '#' && l.peekChar() == '!' && l.lastRead == 0:
+			l.skipLine()
+		case l.ch == '#':
+			l.skipHashComment()
+		default:
+			return
+		}
+	}
+}
+
+//skipLine leaves l.ch at the newline, or at the end of the input.
+func (l *Lexer) skipLine() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.read()
+	}
+}
+
+//Enters with l.ch at the / of the opening /*.
+func (l *Lexer) skipBlockComment() {
+	start := l.position()
+	l.read()
+	depth := 1
+	for depth > 0 {
+		l.read()
+		switch {
+		case l.ch == 0:
+			l.errorAt(token.Span{Start: start, End: l.position()}, diag.UnterminatedComment, "unterminated block comment").Hint = "add a closing */"
+			return
+		case l.ch == '/' && l.peekChar() == '*':
+			l.read()
+			depth++
+		case l.ch == '*' && l.peekChar() == '/':
+			l.read()
+			depth--
+		}
+	}
+	l.read()
+}
+
+//Enters with l.ch at the opening #.
+func (l *Lexer) skipHashComment() {
+	start := l.position()
 	l.read()
 	for l.ch != '#' {
 		if l.ch == 0 {
+			l.errorAt(token.Span{Start: start, End: l.endPosition()}, diag.UnterminatedComment, "unterminated # comment").Hint = "add a closing #, or use // for a comment up to the end of the line"
 			return
 		}
 		l.read()
 	}
 	l.read()
+}
 
+func (l *Lexer) position() token.Position {
+	return token.Position{File: l.file, Offset: l.lastRead, Line: l.line, Column: l.col}
+}
+
+//endPosition is the position just past l.ch.
+func (l *Lexer) endPosition() token.Position {
+	if l.ch == '\n' {
+		return token.Position{File: l.file, Offset: l.readPos, Line: l.line + 1, Column: 1}
+	}
+	return token.Position{File: l.file, Offset: l.readPos, Line: l.line, Column: l.col + 1}
 }
 
 //for two character token
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPos >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPos]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPos:])
+	return ch
 
 }
@@ -1,8 +1,10 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/Revolyssup/monkey/diag"
 	"github.com/Revolyssup/monkey/token"
 )
 
@@ -14,11 +16,16 @@ func TestNextToken(t *testing.T) {
 	};
 	let result = add(five, ten);
 
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5==5!=67;
 	"foobar"
 	"foo bar"
 	[1,]
+	10 % 3
+	a <= b >= c && d || e
+	x += 1 -= 2 *= 3 /= 4; x++ y--
+	match (x) { _ => 1 }
+	a & b | c ^ ~d << 1 >> 2
 	 `
 	tests := []struct {
 		Type    token.TokenType
@@ -82,6 +89,53 @@ func TestNextToken(t *testing.T) {
 		{token.INTEGER, "1"},
 		{token.COMMA, ","},
 		{token.RIGHT_LARGE_BRACKET, "]"},
+		{token.INTEGER, "10"},
+		{token.MODULO, "%"},
+		{token.INTEGER, "3"},
+		{token.IDENTIFIER, "a"},
+		{token.LESS_EQUAL, "<="},
+		{token.IDENTIFIER, "b"},
+		{token.GRTR_EQUAL, ">="},
+		{token.IDENTIFIER, "c"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "d"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "e"},
+		{token.IDENTIFIER, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INTEGER, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INTEGER, "2"},
+		{token.ASTERIK_ASSIGN, "*="},
+		{token.INTEGER, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INTEGER, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.INCREMENT, "++"},
+		{token.IDENTIFIER, "y"},
+		{token.DECREMENT, "--"},
+		{token.MATCH, "match"},
+		{token.LEFT_BRACKET, "("},
+		{token.IDENTIFIER, "x"},
+		{token.RIGHT_BRACKET, ")"},
+		{token.LEFT_BRACE, "{"},
+		{token.WILDCARD, "_"},
+		{token.FAT_ARROW, "=>"},
+		{token.INTEGER, "1"},
+		{token.RIGHT_BRACE, "}"},
+		{token.IDENTIFIER, "a"},
+		{token.BIT_AND, "&"},
+		{token.IDENTIFIER, "b"},
+		{token.BIT_OR, "|"},
+		{token.IDENTIFIER, "c"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENTIFIER, "d"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.INTEGER, "1"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.INTEGER, "2"},
 
 		{token.EOF, ""},
 	}
@@ -102,3 +156,370 @@ func TestNextToken(t *testing.T) {
 
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 10;
+  x == "ab"`
+	tests := []struct {
+		Literal string
+		Line    int
+		Column  int
+		Offset  int
+		End     int
+	}{
+		{"let", 1, 1, 0, 3},
+		{"x", 1, 5, 4, 5},
+		{"=", 1, 7, 6, 7},
+		{"10", 1, 9, 8, 10},
+		{";", 1, 11, 10, 11},
+		{"x", 2, 3, 14, 15},
+		{"==", 2, 5, 16, 18},
+		{"ab", 2, 8, 19, 23},
+		{"", 2, 12, 23, 23},
+	}
+
+	lex := NewFile("test.mon", input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+		if tok.Literal != tt.Literal {
+			t.Fatalf("test[%d]: Wrong Literal. Expected %q--Got %q", i, tt.Literal, tok.Literal)
+		}
+		if tok.Pos.File != "test.mon" {
+			t.Errorf("test[%d]: Wrong file. Expected %q--Got %q", i, "test.mon", tok.Pos.File)
+		}
+		if tok.Pos.Line != tt.Line || tok.Pos.Column != tt.Column {
+			t.Errorf("test[%d]: Wrong position. Expected %d:%d--Got %d:%d", i, tt.Line, tt.Column, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Offset != tt.Offset || tok.End.Offset != tt.End {
+			t.Errorf("test[%d]: Wrong offsets. Expected [%d,%d)--Got [%d,%d)", i, tt.Offset, tt.End, tok.Pos.Offset, tok.End.Offset)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let größe = user_id2 + _x + 名前; _ "añ" @ é`
+	tests := []struct {
+		Type    token.TokenType
+		Literal string
+		Column  int
+		Offset  int
+	}{
+		{token.LET, "let", 1, 0},
+		{token.IDENTIFIER, "größe", 5, 4},
+		{token.ASSIGN, "=", 11, 12},
+		{token.IDENTIFIER, "user_id2", 13, 14},
+		{token.PLUS, "+", 22, 23},
+		{token.IDENTIFIER, "_x", 24, 25},
+		{token.PLUS, "+", 27, 28},
+		{token.IDENTIFIER, "名前", 29, 30},
+		{token.SEMICOLON, ";", 31, 36},
+		{token.WILDCARD, "_", 33, 38},
+		{token.STRING, "añ", 35, 40},
+		{token.ILLEGAL, "@", 40, 46},
+		{token.IDENTIFIER, "é", 42, 48},
+		{token.EOF, "", 43, 50},
+	}
+
+	lex := New(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+		if tok.Type != tt.Type {
+			t.Fatalf("test[%d]: Wrong Type Token. Expected %q--Got %q", i, tt.Type, tok.Type)
+		}
+		if tok.Literal != tt.Literal {
+			t.Fatalf("test[%d]: Wrong Literal. Expected %q--Got %q", i, tt.Literal, tok.Literal)
+		}
+		if tok.Pos.Column != tt.Column || tok.Pos.Offset != tt.Offset {
+			t.Errorf("test[%d]: Wrong position. Expected column %d, offset %d--Got column %d, offset %d", i, tt.Column, tt.Offset, tok.Pos.Column, tok.Pos.Offset)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	l := New("\"a\xffb\" x")
+	tok := l.NextToken()
+	if tok.Type != token.STRING || tok.Literal != "a\uFFFDb" {
+		t.Errorf("wrong token. got=%q %q", tok.Type, tok.Literal)
+	}
+	if next := l.NextToken(); next.Literal != "x" || next.Pos.Column != 7 {
+		t.Errorf("wrong token after the string. got=%q at column %d", next.Literal, next.Pos.Column)
+	}
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got=%d (%v)", len(errors), errors)
+	}
+	if errors[0].Code != diag.InvalidUTF8 || errors[0].Message != "invalid UTF-8 byte 0xff" || errors[0].Span.Start.Column != 3 {
+		t.Errorf("wrong error. got=%s %q at %s", errors[0].Code, errors[0].Message, errors[0].Span.Start)
+	}
+}
+
+func TestClosingBraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.TokenType
+	}{
+		{"{ { }}", []token.TokenType{token.LEFT_BRACE, token.LEFT_BRACE, token.RIGHT_BRACE, token.RIGHT_BRACE}},
+		{"{{ }}", []token.TokenType{token.LEFT_OBJECT_BRACE, token.RIGHT_OBJECT_BRACE}},
+		{"{ {{ }}}", []token.TokenType{token.LEFT_BRACE, token.LEFT_OBJECT_BRACE, token.RIGHT_OBJECT_BRACE, token.RIGHT_BRACE}},
+		{"{{ { }}}", []token.TokenType{token.LEFT_OBJECT_BRACE, token.LEFT_BRACE, token.RIGHT_BRACE, token.RIGHT_OBJECT_BRACE}},
+		{"{{ {{ }}}}", []token.TokenType{token.LEFT_OBJECT_BRACE, token.LEFT_OBJECT_BRACE, token.RIGHT_OBJECT_BRACE, token.RIGHT_OBJECT_BRACE}},
+		{"{ { { }}}", []token.TokenType{token.LEFT_BRACE, token.LEFT_BRACE, token.LEFT_BRACE, token.RIGHT_BRACE, token.RIGHT_BRACE, token.RIGHT_BRACE}},
+		//with nothing open, }} is still one token
+		{"}}", []token.TokenType{token.RIGHT_OBJECT_BRACE}},
+	}
+	for _, tt := range tests {
+		l := New(tt.input)
+		got := []token.TokenType{}
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			got = append(got, tok.Type)
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: wrong tokens. expected=%q, got=%q", tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%q: wrong tokens. expected=%q, got=%q", tt.input, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `3.14 42 0.5 7.x 1. 0xFF 0o755 0b1010 1_000_000 1.5e-3 2E+8 1e5 3e 0b12 0x1fz 10_ 4.e3`
+	tests := []struct {
+		Type    token.TokenType
+		Literal string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.INTEGER, "42"},
+		{token.FLOAT, "0.5"},
+		{token.INTEGER, "7"},
+		{token.ILLEGAL, "."},
+		{token.IDENTIFIER, "x"},
+		{token.INTEGER, "1"},
+		{token.ILLEGAL, "."},
+		{token.INTEGER, "0xFF"},
+		{token.INTEGER, "0o755"},
+		{token.INTEGER, "0b1010"},
+		{token.INTEGER, "1_000_000"},
+		{token.FLOAT, "1.5e-3"},
+		{token.FLOAT, "2E+8"},
+		{token.FLOAT, "1e5"},
+		{token.INTEGER, "3"},
+		{token.IDENTIFIER, "e"},
+		{token.INTEGER, "0b12"},
+		{token.INTEGER, "0x1fz"},
+		{token.INTEGER, "10_"},
+		{token.INTEGER, "4"},
+		{token.ILLEGAL, "."},
+		{token.IDENTIFIER, "e3"},
+		{token.EOF, ""},
+	}
+
+	lex := New(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+		if tok.Type != tt.Type {
+			t.Fatalf("test[%d]: Wrong Type Token. Expected %q--Got %q", i, tt.Type, tok.Type)
+		}
+		if tok.Literal != tt.Literal {
+			t.Fatalf("test[%d]: Wrong Literal. Expected %q--Got %q", i, tt.Literal, tok.Literal)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain"`, "plain"},
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"caf\u{e9} \u{1F600}"`, "café 😀"},
+		{`"{\"port\": 8080}"`, `{"port": 8080}`},
+		{"`raw \\n \"quoted\"`", `raw \n "quoted"`},
+		{"`line one\nline two`", "line one\nline two"},
+		{"``", ""},
+	}
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != token.STRING {
+			t.Fatalf("%q: wrong token type. expected STRING, got=%q", tt.input, tok.Type)
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("%q: wrong literal. expected=%q, got=%q", tt.input, tt.expected, tok.Literal)
+		}
+		if len(l.Errors()) != 0 {
+			t.Errorf("%q: unexpected errors %v", tt.input, l.Errors())
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%q: string did not end at the closing quote, next token is %q", tt.input, next.Literal)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"Hi ${name}!" "a${x}b${ {{"k": 1}}["k"] }c" "${ "in${y}" }" "\${no} $5" "${x}}" "${if (a) { 1 }}"`
+	tests := []struct {
+		Type    token.TokenType
+		Literal string
+	}{
+		{token.STRING_HEAD, "Hi "},
+		{token.IDENTIFIER, "name"},
+		{token.STRING_END, "!"},
+		{token.STRING_HEAD, "a"},
+		{token.IDENTIFIER, "x"},
+		{token.STRING_MIDDLE, "b"},
+		{token.LEFT_OBJECT_BRACE, "{"},
+		{token.STRING, "k"},
+		{token.KEY_VAL_SEP, ":"},
+		{token.INTEGER, "1"},
+		{token.RIGHT_OBJECT_BRACE, "}"},
+		{token.LEFT_LARGE_BRACKET, "["},
+		{token.STRING, "k"},
+		{token.RIGHT_LARGE_BRACKET, "]"},
+		{token.STRING_END, "c"},
+		{token.STRING_HEAD, ""},
+		{token.STRING_HEAD, "in"},
+		{token.IDENTIFIER, "y"},
+		{token.STRING_END, ""},
+		{token.STRING_END, ""},
+		{token.STRING, "${no} $5"},
+		{token.STRING_HEAD, ""},
+		{token.IDENTIFIER, "x"},
+		{token.STRING_END, "}"},
+		{token.STRING_HEAD, ""},
+		{token.IF, "if"},
+		{token.LEFT_BRACKET, "("},
+		{token.IDENTIFIER, "a"},
+		{token.RIGHT_BRACKET, ")"},
+		{token.LEFT_BRACE, "{"},
+		{token.INTEGER, "1"},
+		{token.RIGHT_BRACE, "}"},
+		{token.STRING_END, ""},
+		{token.EOF, ""},
+	}
+
+	lex := New(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+		if tok.Type != tt.Type {
+			t.Fatalf("test[%d]: Wrong Type Token. Expected %q--Got %q", i, tt.Type, tok.Type)
+		}
+		if tok.Literal != tt.Literal {
+			t.Fatalf("test[%d]: Wrong Literal. Expected %q--Got %q", i, tt.Literal, tok.Literal)
+		}
+	}
+	if len(lex.Errors()) != 0 {
+		t.Errorf("unexpected errors %v", lex.Errors())
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"a // to the end\nb", []string{"a", "b"}},
+		{"a /* b */ c", []string{"a", "c"}},
+		{"a /* outer /* inner */ still comment */ b", []string{"a", "b"}},
+		{"/* one */ /* two */ // three\n# four # x", []string{"x"}},
+		{"# one ## two #\n// three\n/* four */ x", []string{"x"}},
+		{"#!/usr/bin/env monkey\nlet x", []string{"let", "x"}},
+		{"x #! not a shebang # y", []string{"x", "y"}},
+		{"a / b /= c", []string{"a", "/", "b", "/=", "c"}},
+		{"a /**/ b /*/ c */ d", []string{"a", "b", "d"}},
+		{"\"// not a comment\" `/* nor this */`", []string{"// not a comment", "/* nor this */"}},
+	}
+	for _, tt := range tests {
+		l := New(tt.input)
+		got := []string{}
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			got = append(got, tok.Literal)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%q: wrong tokens. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if len(l.Errors()) != 0 {
+			t.Errorf("%q: unexpected errors %v", tt.input, l.Errors())
+		}
+	}
+}
+
+func TestUnterminatedComments(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    int
+		column  int
+	}{
+		{"x /* never closed", "unterminated block comment", 1, 3},
+		{"x /* outer /* inner */\n", "unterminated block comment", 1, 3},
+		{"x\n  # stray hash", "unterminated # comment", 2, 3},
+		{"x #!/not/first/line", "unterminated # comment", 1, 3},
+	}
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got=%d (%v)", tt.input, len(errors), errors)
+		}
+		d := errors[0]
+		if d.Code != diag.UnterminatedComment || d.Message != tt.message {
+			t.Errorf("%q: wrong error. expected=%s %q, got=%s %q", tt.input, diag.UnterminatedComment, tt.message, d.Code, d.Message)
+		}
+		if d.Span.Start.Line != tt.line || d.Span.Start.Column != tt.column {
+			t.Errorf("%q: wrong position. expected=%d:%d, got=%s", tt.input, tt.line, tt.column, d.Span.Start)
+		}
+	}
+}
+
+func TestStringDiagnostics(t *testing.T) {
+	tests := []struct {
+		input   string
+		code    string
+		message string
+		line    int
+		column  int
+		literal string
+	}{
+		{"let s = \"abc", diag.UnterminatedString, "unterminated string", 1, 9, "abc"},
+		{"\"ab\\", diag.UnterminatedString, "unterminated string", 1, 1, "ab"},
+		{"x\n`abc\ndef", diag.UnterminatedString, "unterminated raw string", 2, 1, "abc\ndef"},
+		{`"a\qb"`, diag.InvalidEscape, `unknown escape sequence \q`, 1, 3, `a\qb`},
+		{`"\u{e9"`, diag.InvalidEscape, "invalid unicode escape", 1, 2, ""},
+		{`"\u{}"`, diag.InvalidEscape, "invalid unicode escape", 1, 2, "}"},
+		{`"\u{110000}"`, diag.InvalidEscape, "invalid unicode code point 110000", 1, 2, ""},
+	}
+	for _, tt := range tests {
+		l := New(tt.input)
+		var tok token.Token
+		for tok = l.NextToken(); tok.Type != token.STRING && tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		if tok.Literal != tt.literal {
+			t.Errorf("%q: wrong literal. expected=%q, got=%q", tt.input, tt.literal, tok.Literal)
+		}
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got=%d (%v)", tt.input, len(errors), errors)
+		}
+		d := errors[0]
+		if d.Code != tt.code || d.Message != tt.message {
+			t.Errorf("%q: wrong error. expected=%s %q, got=%s %q", tt.input, tt.code, tt.message, d.Code, d.Message)
+		}
+		if d.Span.Start.Line != tt.line || d.Span.Start.Column != tt.column {
+			t.Errorf("%q: wrong position. expected=%d:%d, got=%s", tt.input, tt.line, tt.column, d.Span.Start)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/user"
 
+	"github.com/Revolyssup/monkey/diag"
 	"github.com/Revolyssup/monkey/eval"
 	"github.com/Revolyssup/monkey/lexer"
 	"github.com/Revolyssup/monkey/obj"
@@ -25,7 +26,7 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
-		run(fileact, os.Stdout)
+		run(os.Args[1], fileact, os.Stdout)
 
 		return
 	}
@@ -34,19 +35,25 @@ func main() {
 	repl.StartRepl(os.Stdin, os.Stdout)
 }
 
-func run(input string, out io.Writer) {
+func run(file string, input string, out io.Writer) {
 
 	env := obj.NewEnvironment()
-	l := lexer.New(input)
+	l := lexer.NewFile(file, input)
 
 	p := parser.New(l)
 
 	program := p.ParseProgram()
 	if len(p.Errors()) != 0 {
-		repl.PrintParserErrors(out, p.Errors())
+		repl.PrintParserErrors(out, input, p.Errors())
+		return
 	}
 
 	evalObj := eval.Eval(program, env)
+	if err, ok := evalObj.(*obj.Error); ok {
+		io.WriteString(out, err.Traceback())
+		diag.Render(out, input, err.Diagnostic())
+		return
+	}
 	if evalObj != nil {
 		io.WriteString(out, evalObj.Inspect())
 		io.WriteString(out, "\n")
@@ -3,24 +3,33 @@ package obj
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/Revolyssup/monkey/ast"
+	"github.com/Revolyssup/monkey/diag"
+	"github.com/Revolyssup/monkey/token"
 )
 
 type DataType string
 
 const (
 	INTEGER_OBJ      = "Integer"
+	FLOAT_OBJ        = "Float"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "Bool"
 	NULL_OBJ         = "Null"
 	RETURN_OBJ       = "Return"
+	BREAK_OBJ        = "Break"
+	CONTINUE_OBJ     = "Continue"
 	ERROR_OBJ        = "Error"
 	FUNCTION_OBJ     = "Function"
 	BUILTIN_FUNC_OBJ = "Builtin_function"
 	ARRAYS_OBJ       = "Array"
 	OBJECT_OBJ       = "Object"
+	RANGE_OBJ        = "Range"
 )
 
 //All variables will be wrapped inside of an object-like struct.
@@ -28,6 +37,19 @@ const (
 type Object interface {
 	DataType() DataType
 	Inspect() string
+	Equal(other Object) bool //what == means in monkey. Values of different types are never equal, numbers excepted
+}
+
+//HashKey is what a value is stored under when used as an object key. The type is part of it, so 1 and "1" are different keys.
+type HashKey struct {
+	Type  DataType
+	Value string
+}
+
+//Hashable is implemented by the values that can be used as object keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
 }
 
 //Implementing Integers
@@ -42,6 +64,110 @@ func (integer *Integer) DataType() DataType {
 func (integer *Integer) Inspect() string {
 	return fmt.Sprintf("%d", integer.Value)
 }
+func (integer *Integer) Equal(other Object) bool {
+	return numbersEqual(integer, other)
+}
+func (integer *Integer) HashKey() HashKey {
+	return HashKey{Type: INTEGER_OBJ, Value: strconv.FormatInt(integer.Value, 10)}
+}
+
+//BigInteger holds the integers that do not fit in an int64. To monkey code it is just another Integer: operations that
+//overflow an int64 promote to it, and results that fit again are turned back into an Integer by NewInteger.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (integer *BigInteger) DataType() DataType {
+	return INTEGER_OBJ
+}
+func (integer *BigInteger) Inspect() string {
+	return integer.Value.String()
+}
+func (integer *BigInteger) Equal(other Object) bool {
+	return numbersEqual(integer, other)
+}
+func (integer *BigInteger) HashKey() HashKey {
+	return HashKey{Type: INTEGER_OBJ, Value: integer.Value.String()}
+}
+
+//NewInteger returns the smallest representation of the given value: an Integer if it fits in an int64, else a BigInteger.
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+//ToBig returns the value of an Integer or a BigInteger as a big.Int, that the caller is free to modify.
+func ToBig(integer Object) *big.Int {
+	switch integer := integer.(type) {
+	case *Integer:
+		return big.NewInt(integer.Value)
+	case *BigInteger:
+		return new(big.Int).Set(integer.Value)
+	}
+	return nil
+}
+
+//Implementing Floats
+type Float struct {
+	Value float64
+}
+
+func (f *Float) DataType() DataType {
+	return FLOAT_OBJ
+}
+
+//Whole numbers keep a trailing .0, so that a float never prints like an integer.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f *Float) Equal(other Object) bool {
+	return numbersEqual(f, other)
+}
+
+//A whole float is the same key as the equal integer, as 1.0 == 1.
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		whole, _ := big.NewFloat(f.Value).Int(nil)
+		return HashKey{Type: INTEGER_OBJ, Value: whole.String()}
+	}
+	return HashKey{Type: FLOAT_OBJ, Value: strconv.FormatFloat(f.Value, 'g', -1, 64)}
+}
+
+//numbersEqual compares numbers exactly, whatever their representation. Anything that is not a number is unequal.
+func numbersEqual(a, b Object) bool {
+	if a, ok := a.(*Integer); ok {
+		if b, ok := b.(*Integer); ok {
+			return a.Value == b.Value
+		}
+	}
+	af, aIsFloat := a.(*Float)
+	bf, bIsFloat := b.(*Float)
+	switch {
+	case aIsFloat && bIsFloat:
+		return af.Value == bf.Value
+	case aIsFloat:
+		return floatEqualsInteger(af.Value, b)
+	case bIsFloat:
+		return floatEqualsInteger(bf.Value, a)
+	}
+	ab, bb := ToBig(a), ToBig(b)
+	return ab != nil && bb != nil && ab.Cmp(bb) == 0
+}
+
+func floatEqualsInteger(f float64, integer Object) bool {
+	i := ToBig(integer)
+	if i == nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return false
+	}
+	return big.NewFloat(f).Cmp(new(big.Float).SetInt(i)) == 0
+}
 
 //Implementing String
 type String struct {
@@ -55,6 +181,13 @@ func (s *String) DataType() DataType {
 func (s *String) Inspect() string {
 	return s.Value
 }
+func (s *String) Equal(other Object) bool {
+	o, ok := other.(*String)
+	return ok && s.Value == o.Value
+}
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: STRING_OBJ, Value: s.Value}
+}
 
 //Implementing Booleans
 type Boolean struct {
@@ -68,6 +201,13 @@ func (boolean *Boolean) DataType() DataType {
 func (boolean *Boolean) Inspect() string {
 	return fmt.Sprintf("%t", boolean.Value)
 }
+func (boolean *Boolean) Equal(other Object) bool {
+	o, ok := other.(*Boolean)
+	return ok && boolean.Value == o.Value
+}
+func (boolean *Boolean) HashKey() HashKey {
+	return HashKey{Type: BOOLEAN_OBJ, Value: strconv.FormatBool(boolean.Value)}
+}
 
 //Implementing Null
 type Null struct{} //it holds no value
@@ -78,6 +218,10 @@ func (null *Null) DataType() DataType {
 func (null *Null) Inspect() string {
 	return "null"
 }
+func (null *Null) Equal(other Object) bool {
+	_, ok := other.(*Null)
+	return ok
+}
 
 //Implementing  Return
 type Return struct {
@@ -91,10 +235,43 @@ func (ret *Return) DataType() DataType {
 func (ret *Return) Inspect() string {
 	return ret.Value.Inspect()
 }
+func (ret *Return) Equal(other Object) bool {
+	o, ok := other.(*Return)
+	return ok && ret.Value.Equal(o.Value)
+}
+
+//Break and Continue are signals like Return. They travel up through the blocks until the loop they belong to stops them.
+type Break struct{}
+
+func (b *Break) DataType() DataType {
+	return BREAK_OBJ
+}
+func (b *Break) Inspect() string {
+	return "break"
+}
+func (b *Break) Equal(other Object) bool {
+	_, ok := other.(*Break)
+	return ok
+}
+
+type Continue struct{}
+
+func (c *Continue) DataType() DataType {
+	return CONTINUE_OBJ
+}
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+func (c *Continue) Equal(other Object) bool {
+	_, ok := other.(*Continue)
+	return ok
+}
 
 //Implementing Error object is similar to Return as they both stop the execution of program and return something
 type Error struct {
 	ErrMsg string
+	Span   token.Span //source of the expression that failed
+	Stack  []Frame    //the calls that were active when it happened, outermost first
 }
 
 func (err *Error) DataType() DataType {
@@ -102,7 +279,42 @@ func (err *Error) DataType() DataType {
 }
 
 func (err *Error) Inspect() string {
-	return "[MONKE ANGRY:] " + err.ErrMsg
+	return err.Traceback() + "[MONKE ANGRY:] " + err.ErrMsg
+}
+
+//Errors are only equal to themselves.
+func (err *Error) Equal(other Object) bool {
+	return Object(err) == other
+}
+
+//Traceback lists the calls that led to the error, python style, ending with the place where the error happened.
+//It is empty for errors that happened outside of any function.
+func (err *Error) Traceback() string {
+	if len(err.Stack) == 0 {
+		return ""
+	}
+	var out bytes.Buffer
+	out.WriteString("Traceback (most recent call last):\n")
+	caller := "<main>"
+	for _, frame := range err.Stack {
+		out.WriteString(traceLine(frame.Pos, caller))
+		caller = frame.Name
+	}
+	out.WriteString(traceLine(err.Span.Start, caller))
+	return out.String()
+}
+
+func traceLine(pos token.Position, in string) string {
+	file := pos.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("  File %q, line %d, column %d, in %s\n", file, pos.Line, pos.Column, in)
+}
+
+//Diagnostic describes the error the same way parser errors are described, so it can be rendered against the source.
+func (err *Error) Diagnostic() diag.Diagnostic {
+	return diag.Errorf(err.Span, diag.RuntimeError, "%s", err.ErrMsg)
 }
 
 //Environment object will passed around recursively in Eval
@@ -110,21 +322,40 @@ func (err *Error) Inspect() string {
 type Env struct {
 	variables map[string]Object
 	outer     *Env
+	stack     *CallStack
 }
 
+//Get looks the variable up in this scope first, then in each enclosing scope in turn.
 func (env *Env) Get(s string) (Object, bool) {
-	ob, ok := env.variables[s]
-	return ob, ok
+	for scope := env; scope != nil; scope = scope.outer {
+		if ob, ok := scope.variables[s]; ok {
+			return ob, true
+		}
+	}
+	return nil, false
 }
 
-func (env *Env) Set(s string, ob Object) Object {
+//Define creates the variable in this scope, shadowing any variable with the same name in the enclosing scopes.
+func (env *Env) Define(s string, ob Object) Object {
 	env.variables[s] = ob
 	return ob
 }
 
+//Assign changes the value of an existing variable, in the innermost scope that has it.
+//It reports false, and changes nothing, when no scope has the variable.
+func (env *Env) Assign(s string, ob Object) (Object, bool) {
+	for scope := env; scope != nil; scope = scope.outer {
+		if _, ok := scope.variables[s]; ok {
+			scope.variables[s] = ob
+			return ob, true
+		}
+	}
+	return nil, false
+}
+
 func NewEnvironment() *Env {
 	s := make(map[string]Object)
-	env := &Env{variables: s, outer: nil}
+	env := &Env{variables: s, outer: nil, stack: &CallStack{}}
 	return env
 }
 
@@ -132,12 +363,47 @@ func NewEnvironment() *Env {
 func NewEnclosedEnvironment(outer_env *Env) *Env {
 	env := NewEnvironment()
 	env.outer = outer_env
+	env.stack = outer_env.stack
 	return env
 }
 
+//The call stack is shared by an environment and all the environments enclosed in it.
+func (env *Env) CallStack() *CallStack {
+	return env.stack
+}
+
+/*****************/
+//CALL STACK
+
+//Frame is one active function call.
+type Frame struct {
+	Name string         //name of the called function, or <anonymous>
+	Pos  token.Position //where the function was called from
+}
+
+type CallStack struct {
+	frames []Frame
+}
+
+func (cs *CallStack) Push(frame Frame) {
+	cs.frames = append(cs.frames, frame)
+}
+
+func (cs *CallStack) Pop() {
+	cs.frames = cs.frames[:len(cs.frames)-1]
+}
+
+//Frames returns a copy of the active calls, outermost first.
+func (cs *CallStack) Frames() []Frame {
+	frames := make([]Frame, len(cs.frames))
+	copy(frames, cs.frames)
+	return frames
+}
+
 /*****************/
 //FUNCTIONS
 type Function struct {
+	Name string //name it was first bound to with let, empty for anonymous functions
 	Args []*ast.Identifier
 	Body *ast.BlockStatement
 	Env  *Env
@@ -165,6 +431,11 @@ func (fn *Function) Inspect() string { //Returns all params
 	return out.String()
 }
 
+//Two functions with the same code are still different functions, as they can close over different variables.
+func (fn *Function) Equal(other Object) bool {
+	return Object(fn) == other
+}
+
 /***********/
 //Builtin Functions
 type BuiltinFn func(args ...Object) Object
@@ -179,6 +450,9 @@ func (b *Builtin) DataType() DataType {
 func (b *Builtin) Inspect() string {
 	return "monkey in-built function"
 }
+func (b *Builtin) Equal(other Object) bool {
+	return Object(b) == other
+}
 
 /**************/
 //Array- Different data types can be added to array.
@@ -190,32 +464,179 @@ func (a *Array) DataType() DataType {
 	return ARRAYS_OBJ
 }
 func (a *Array) Inspect() string {
-	var out bytes.Buffer
-	out.WriteString("[")
-	for _, ele := range a.Arr {
-		out.WriteString(ele.Inspect() + ",")
+	return inspect(a, map[Object]bool{})
+}
+
+//Arrays are equal when they have equal elements in the same order.
+func (a *Array) Equal(other Object) bool {
+	return deepEqual(a, other, map[[2]Object]bool{})
+}
+
+/**************/
+//Range- the integers from Start up to, but not including, End, going by Step. Made by the range builtin for for-in loops,
+//it does not hold its numbers, so big ranges cost nothing.
+type Range struct {
+	Start, End, Step int64
+}
 
+func (r *Range) DataType() DataType {
+	return RANGE_OBJ
+}
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.End)
 	}
-	out.WriteString("]")
-	return out.String()
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+func (r *Range) Equal(other Object) bool {
+	o, ok := other.(*Range)
+	return ok && *r == *o
+}
+
+//Len is the number of integers in the range.
+func (r *Range) Len() int64 {
+	if r.Step > 0 && r.Start < r.End {
+		return (r.End-r.Start-1)/r.Step + 1
+	}
+	if r.Step < 0 && r.Start > r.End {
+		return (r.Start-r.End-1)/-r.Step + 1
+	}
+	return 0
+}
+
+//At returns the i'th integer of the range.
+func (r *Range) At(i int64) int64 {
+	return r.Start + i*r.Step
 }
 
 /**************/
-//Object
+//Object- a hash map that remembers the order in which keys were first inserted, so that Inspect is deterministic.
 type Obj struct {
-	OBJ map[string]Object
+	index map[HashKey]int //position of each key in pairs
+	pairs []ObjPair
+}
+
+type ObjPair struct {
+	Key   Hashable
+	Value Object
+}
+
+func NewObj() *Obj {
+	return &Obj{index: map[HashKey]int{}}
 }
 
 func (o *Obj) DataType() DataType {
 	return OBJECT_OBJ
 }
 func (o *Obj) Inspect() string {
-	var out bytes.Buffer
-	out.WriteString("{")
-	for key, val := range o.OBJ {
-		out.WriteString(key + ":" + val.Inspect() + ",\n")
+	return inspect(o, map[Object]bool{})
+}
 
+func (o *Obj) Get(key Hashable) (Object, bool) {
+	i, ok := o.index[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return o.pairs[i].Value, true
+}
+
+//Set replaces the value of an existing key in place, and appends new keys at the end.
+func (o *Obj) Set(key Hashable, val Object) {
+	hk := key.HashKey()
+	if i, ok := o.index[hk]; ok {
+		o.pairs[i].Value = val
+		return
+	}
+	if o.index == nil {
+		o.index = map[HashKey]int{}
+	}
+	o.index[hk] = len(o.pairs)
+	o.pairs = append(o.pairs, ObjPair{Key: key, Value: val})
+}
+
+//Pairs returns the entries in insertion order.
+func (o *Obj) Pairs() []ObjPair {
+	return append([]ObjPair(nil), o.pairs...)
+}
+
+func (o *Obj) Len() int {
+	return len(o.pairs)
+}
+
+//Objects are equal when they have the same keys with equal values. The order of the keys does not matter.
+func (o *Obj) Equal(other Object) bool {
+	return deepEqual(o, other, map[[2]Object]bool{})
+}
+
+//inspect writes arrays and objects out element by element. They can hold themselves, e.g. after a[0] = a, so open
+//holds the ones being written further up, and one met again inside itself is written as [...] or {...}.
+func inspect(ob Object, open map[Object]bool) string {
+	var out bytes.Buffer
+	switch ob := ob.(type) {
+	case *Array:
+		if open[ob] {
+			return "[...]"
+		}
+		open[ob] = true
+		defer delete(open, ob)
+		out.WriteString("[")
+		for _, ele := range ob.Arr {
+			out.WriteString(inspect(ele, open) + ",")
+		}
+		out.WriteString("]")
+	case *Obj:
+		if open[ob] {
+			return "{...}"
+		}
+		open[ob] = true
+		defer delete(open, ob)
+		out.WriteString("{")
+		for _, pair := range ob.pairs {
+			out.WriteString(pair.Key.Inspect() + ":" + inspect(pair.Value, open) + ",\n")
+		}
+		out.WriteString("}")
+	default:
+		return ob.Inspect()
 	}
-	out.WriteString("}")
 	return out.String()
 }
+
+//deepEqual compares arrays and objects element by element. seen holds the pairs already being compared, and a pair
+//met again is taken as equal, so that two values which hold themselves compare without looping.
+func deepEqual(a, b Object, seen map[[2]Object]bool) bool {
+	switch a := a.(type) {
+	case *Array:
+		o, ok := b.(*Array)
+		if !ok || len(a.Arr) != len(o.Arr) {
+			return false
+		}
+		if a == o || seen[[2]Object{a, o}] {
+			return true
+		}
+		seen[[2]Object{a, o}] = true
+		for i, ele := range a.Arr {
+			if !deepEqual(ele, o.Arr[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Obj:
+		o, ok := b.(*Obj)
+		if !ok || a.Len() != o.Len() {
+			return false
+		}
+		if a == o || seen[[2]Object{a, o}] {
+			return true
+		}
+		seen[[2]Object{a, o}] = true
+		for _, pair := range a.pairs {
+			val, ok := o.Get(pair.Key)
+			if !ok || !deepEqual(pair.Value, val, seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Equal(b)
+	}
+}
@@ -0,0 +1,104 @@
+package obj
+
+import "testing"
+
+func TestEnvScopes(t *testing.T) {
+	global := NewEnvironment()
+	global.Define("a", &Integer{Value: 1})
+	global.Define("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(global)
+	inner.Define("b", &Integer{Value: 20}) //shadows the outer b
+
+	tests := []struct {
+		env      *Env
+		name     string
+		expected int64
+	}{
+		{inner, "a", 1},
+		{inner, "b", 20},
+		{global, "b", 2},
+	}
+	for _, tt := range tests {
+		val, ok := tt.env.Get(tt.name)
+		if !ok {
+			t.Fatalf("variable %s not found", tt.name)
+		}
+		if val.(*Integer).Value != tt.expected {
+			t.Errorf("wrong value for %s. expected=%d, got=%d", tt.name, tt.expected, val.(*Integer).Value)
+		}
+	}
+
+	//Assign changes the variable where it lives instead of creating a new one.
+	if _, ok := inner.Assign("a", &Integer{Value: 100}); !ok {
+		t.Fatalf("Assign did not find a")
+	}
+	if val, _ := global.Get("a"); val.(*Integer).Value != 100 {
+		t.Errorf("Assign did not update the outer variable. got=%s", val.Inspect())
+	}
+	if _, ok := inner.Assign("b", &Integer{Value: 200}); !ok {
+		t.Fatalf("Assign did not find b")
+	}
+	if val, _ := global.Get("b"); val.(*Integer).Value != 2 {
+		t.Errorf("Assign changed the shadowed variable. got=%s", val.Inspect())
+	}
+	if _, ok := inner.Assign("missing", &Integer{Value: 1}); ok {
+		t.Errorf("Assign reported success for an undeclared variable")
+	}
+	if _, ok := global.Get("missing"); ok {
+		t.Errorf("Assign created an undeclared variable")
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	tests := []struct {
+		name  string
+		key   Hashable
+		equal bool
+	}{
+		{"same integer", &Integer{Value: 1}, true},
+		{"whole float", &Float{Value: 1.0}, true},
+		{"big integer", &BigInteger{Value: ToBig(one)}, true},
+		{"string", &String{Value: "1"}, false},
+		{"boolean", &Boolean{Value: true}, false},
+		{"other float", &Float{Value: 1.5}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.key.HashKey() == one.HashKey(); got != tt.equal {
+			t.Errorf("%s: HashKey equal to 1 is %t, want %t", tt.name, got, tt.equal)
+		}
+	}
+}
+
+func TestObjKeepsInsertionOrder(t *testing.T) {
+	o := NewObj()
+	o.Set(&String{Value: "b"}, &Integer{Value: 1})
+	o.Set(&Integer{Value: 1}, &Integer{Value: 2})
+	o.Set(&String{Value: "a"}, &Integer{Value: 3})
+	o.Set(&String{Value: "b"}, &Integer{Value: 4}) //updating keeps the original position
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"b", 4},
+		{"1", 2},
+		{"a", 3},
+	}
+	pairs := o.Pairs()
+	if len(pairs) != len(expected) {
+		t.Fatalf("wrong number of pairs. expected=%d, got=%d", len(expected), len(pairs))
+	}
+	for i, want := range expected {
+		if pairs[i].Key.Inspect() != want.key || pairs[i].Value.(*Integer).Value != want.value {
+			t.Errorf("pair %d: expected %s:%d, got %s:%s", i, want.key, want.value, pairs[i].Key.Inspect(), pairs[i].Value.Inspect())
+		}
+	}
+	if _, ok := o.Get(&String{Value: "1"}); ok {
+		t.Errorf("string key \"1\" found an integer key")
+	}
+	if got := o.Inspect(); got != "{b:4,\n1:2,\na:3,\n}" {
+		t.Errorf("wrong Inspect(). got=%q", got)
+	}
+}
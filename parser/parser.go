@@ -1,10 +1,12 @@
 package parser
 
 import (
-	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/Revolyssup/monkey/ast"
+	"github.com/Revolyssup/monkey/diag"
 	"github.com/Revolyssup/monkey/lexer"
 	"github.com/Revolyssup/monkey/token"
 )
@@ -19,7 +21,12 @@ type Parser struct {
 	l         *lexer.Lexer
 	currToken token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []diag.Diagnostic
+	//Set once an error is reported and cleared when the parser has skipped to the next statement.
+	//While it is set, further errors are not reported, as they would only be consequences of the first one.
+	panicking bool
+	panicPos  token.Position //where the error that started the panic was found
+	loopDepth int            //how many for loops enclose the current token, within the current function
 	//Each token type will have some parse function associated with it.
 	infixParsefuncns  map[token.TokenType]infixParsefunc
 	prefixParsefuncns map[token.TokenType]prefixParsefunc
@@ -29,11 +36,19 @@ type Parser struct {
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = and +=, right associative
+	OR          // ||
+	AND         // &&
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
 	EQUALS      // ==
 	LESSGREATER // ><
+	SHIFT       // << and >>
 	SUMSUB      // +
 	PRODUCT     // *
-	PREFIX      // -X and !X
+	PREFIX      // -X, !X and ~X
+	POSTFIX     // X++ and X--
 	CALL        // func(x)
 	INDEX
 )
@@ -44,11 +59,28 @@ var precedence = map[token.TokenType]int{
 	token.NOT_EQUAL:          EQUALS,
 	token.LESS_THAN:          LESSGREATER,
 	token.GRTR_THAN:          LESSGREATER,
+	token.LESS_EQUAL:         LESSGREATER,
+	token.GRTR_EQUAL:         LESSGREATER,
+	token.AND:                AND,
+	token.OR:                 OR,
+	token.BIT_OR:             BITOR,
+	token.BIT_XOR:            BITXOR,
+	token.BIT_AND:            BITAND,
+	token.SHIFT_LEFT:         SHIFT,
+	token.SHIFT_RIGHT:        SHIFT,
 	token.MINUS:              SUMSUB,
 	token.PLUS:               SUMSUB,
 	token.SLASH:              PRODUCT,
 	token.ASTERIK:            PRODUCT,
+	token.MODULO:             PRODUCT,
 	token.BANG:               PREFIX,
+	token.INCREMENT:          POSTFIX,
+	token.DECREMENT:          POSTFIX,
+	token.ASSIGN:             ASSIGN,
+	token.PLUS_ASSIGN:        ASSIGN,
+	token.MINUS_ASSIGN:       ASSIGN,
+	token.ASTERIK_ASSIGN:     ASSIGN,
+	token.SLASH_ASSIGN:       ASSIGN,
 	token.RIGHT_BRACKET:      LOWEST,
 	token.LEFT_BRACKET:       CALL,
 	token.LEFT_LARGE_BRACKET: INDEX,
@@ -70,8 +102,28 @@ func (p *Parser) peekPrecedence() int {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	if t == token.ILLEGAL {
+		p.errorAt(p.currToken.Span(), diag.IllegalCharacter, "illegal character %q", p.currToken.Literal)
+		return
+	}
+	p.errorAt(p.currToken.Span(), diag.NoPrefixParse, "no prefix parse function for %s found", t)
+}
+
+//errorAt records an error diagnostic for the given span and returns it, so that callers can attach a hint.
+func (p *Parser) errorAt(span token.Span, code string, format string, args ...interface{}) *diag.Diagnostic {
+	d := diag.Errorf(span, code, format, args...)
+	if p.panicking {
+		return &d
+	}
+	p.panicking = true
+	p.panicPos = span.Start
+	p.errors = append(p.errors, d)
+	return &p.errors[len(p.errors)-1]
+}
+
+//badExpression stands in for an expression that started at start and could not be parsed.
+func (p *Parser) badExpression(start token.Token) ast.Expression {
+	return &ast.BadExpression{Token: start, End: p.currToken.End}
 }
 
 //Parsing expressions
@@ -81,7 +133,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	if prefix == nil {
 		p.noPrefixParseFnError(p.currToken.Type)
-		return nil
+		return p.badExpression(p.currToken)
 	}
 
 	leftExp := prefix()
@@ -114,9 +166,39 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return iexp
 }
 
+//The left side of x++ is read and written back, so it has to be something that can be assigned to.
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	pexp := &ast.PostfixExpression{Token: p.currToken, LeftExpression: left, Operator: p.currToken.Literal}
+	if !p.checkAssignable(left) {
+		return p.badExpression(pexp.Token)
+	}
+	return pexp
+}
+
+//Assignments bind right to left, so the value is parsed with a precedence just below their own: a = b = 1 is a = (b = 1).
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	aexp := &ast.AssignExpression{Token: p.currToken, Target: left, Operator: p.currToken.Literal}
+	if !p.checkAssignable(left) {
+		return p.badExpression(aexp.Token)
+	}
+	p.NextToken()
+	aexp.Value = p.parseExpression(ASSIGN - 1)
+	return aexp
+}
+
+//checkAssignable reports an error unless target names a variable or an element of an array or object.
+func (p *Parser) checkAssignable(target ast.Expression) bool {
+	switch target.(type) {
+	case *ast.Identifier, *ast.ArrObjElement:
+		return true
+	}
+	p.errorAt(target.Span(), diag.InvalidTarget, "cannot assign to %s", target.String()).Hint = "only variables and elements like a[0] can be assigned to"
+	return false
+}
+
 //Creating instance of the parser.
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []diag.Diagnostic{}}
 	p.NextToken()
 	p.NextToken()
 	p.prefixParsefuncns = make(map[token.TokenType]prefixParsefunc)
@@ -125,15 +207,20 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefixParse(token.IDENTIFIER, p.parseIdentifier)
 	p.registerPrefixParse(token.INTEGER, p.parseIntegerLiteral)
+	p.registerPrefixParse(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefixParse(token.TRUE, p.parseBoolean)
 	p.registerPrefixParse(token.FALSE, p.parseBoolean)
 	p.registerPrefixParse(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixParse(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefixParse(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefixParse(token.LEFT_BRACKET, p.parseGroupedExpression)
 	p.registerPrefixParse(token.IF, p.parseIfExpression)
 	p.registerPrefixParse(token.FOR, p.parseForExpression)
+	p.registerPrefixParse(token.MATCH, p.parseMatchExpression)
+	p.registerPrefixParse(token.WILDCARD, p.parseWildcard)
 	p.registerPrefixParse(token.FUNCTION, p.parseFunctionLiterals)
 	p.registerPrefixParse(token.STRING, p.parseStringLiteral)
+	p.registerPrefixParse(token.STRING_HEAD, p.parseInterpolatedString)
 	p.registerPrefixParse(token.LEFT_LARGE_BRACKET, p.parseArray)
 	p.registerPrefixParse(token.LEFT_OBJECT_BRACE, p.parseObject)
 
@@ -141,10 +228,27 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfixParse(token.MINUS, p.parseInfixExpression)
 	p.registerInfixParse(token.SLASH, p.parseInfixExpression)
 	p.registerInfixParse(token.ASTERIK, p.parseInfixExpression)
+	p.registerInfixParse(token.MODULO, p.parseInfixExpression)
 	p.registerInfixParse(token.EQUAL, p.parseInfixExpression)
 	p.registerInfixParse(token.NOT_EQUAL, p.parseInfixExpression)
 	p.registerInfixParse(token.LESS_THAN, p.parseInfixExpression)
 	p.registerInfixParse(token.GRTR_THAN, p.parseInfixExpression)
+	p.registerInfixParse(token.LESS_EQUAL, p.parseInfixExpression)
+	p.registerInfixParse(token.GRTR_EQUAL, p.parseInfixExpression)
+	p.registerInfixParse(token.AND, p.parseInfixExpression)
+	p.registerInfixParse(token.OR, p.parseInfixExpression)
+	p.registerInfixParse(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfixParse(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfixParse(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfixParse(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfixParse(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfixParse(token.INCREMENT, p.parsePostfixExpression)
+	p.registerInfixParse(token.DECREMENT, p.parsePostfixExpression)
+	p.registerInfixParse(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfixParse(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixParse(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixParse(token.ASTERIK_ASSIGN, p.parseAssignExpression)
+	p.registerInfixParse(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfixParse(token.LEFT_BRACKET, p.parseFunctionCall)
 	p.registerInfixParse(token.LEFT_LARGE_BRACKET, p.parseArrObjElement)
 	p.registerInfixParse(token.LEFT_OBJECT_BRACE, p.parseArrObjElement)
@@ -161,21 +265,72 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.currToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil { //we will get some sort of parsed statement
-			program.Statements = append(program.Statements, stmt)
-		}
+		stmt, _ := p.parseStatementRecovering()
+		program.Statements = append(program.Statements, stmt)
 		p.NextToken()
 	}
 	return program
 }
-func (p *Parser) Errors() []string {
-	return p.errors
+
+//parseStatementRecovering parses a statement, and if an error was found in it, skips whatever is left of it,
+//so that parsing can go on from the next statement.
+//blockEnd reports that the error was an unexpected `}`, which was left as the current token for the enclosing block.
+func (p *Parser) parseStatementRecovering() (stmt ast.Statement, blockEnd bool) {
+	stmt = p.parseStatement()
+	if p.panicking {
+		blockEnd = p.synchronize()
+		p.panicking = false
+	}
+	return stmt, blockEnd
+}
+
+//Statements can safely start again after these tokens.
+var statementStart = map[token.TokenType]bool{
+	token.LET:      true,
+	token.RETURN:   true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+}
+
+//synchronize skips tokens until the current one is a `;` ending the broken statement, or the next one is a `}`, the end of
+//the file or starts a new statement. Braces opened while skipping are skipped as a whole.
+func (p *Parser) synchronize() (blockEnd bool) {
+	if p.currToken.Type == token.RIGHT_BRACE && p.currToken.Pos == p.panicPos {
+		return true
+	}
+	depth := 0
+	if p.currToken.Type == token.LEFT_BRACE {
+		depth++
+	}
+	for p.currToken.Type != token.EOF {
+		if depth == 0 && p.currToken.Type == token.SEMICOLON {
+			return false
+		}
+		if depth == 0 && (statementStart[p.peekToken.Type] || p.peekToken.Type == token.RIGHT_BRACE || p.peekToken.Type == token.EOF) {
+			return false
+		}
+		p.NextToken()
+		switch p.currToken.Type {
+		case token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_BRACE:
+			depth--
+		}
+	}
+	return false
+}
+
+//Errors returns the problems found in the source by the lexer and the parser, in the order they appear in it.
+func (p *Parser) Errors() []diag.Diagnostic {
+	errors := append(append([]diag.Diagnostic{}, p.l.Errors()...), p.errors...)
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Span.Start.Offset < errors[j].Span.Start.Offset
+	})
+	return errors
 }
 
 func (p *Parser) peekErrors(t token.TokenType) {
-	msg := fmt.Sprintf("Expected token type %s. Got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken.Span(), diag.UnexpectedToken, "Expected token type %s. Got %s instead", t, p.peekToken.Type)
 }
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
@@ -187,6 +342,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		{
 			return p.parseReturnStatement()
 		}
+	case token.BREAK, token.CONTINUE:
+		{
+			return p.parseLoopControl()
+		}
 
 	default:
 		{
@@ -197,23 +356,29 @@ func (p *Parser) parseStatement() ast.Statement {
 
 //parsing different types of statements.
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
+	letstmt := p.parseLetBinding()
+	for p.peekToken.Type == token.SEMICOLON && !p.panicking {
+		p.NextToken()
+	}
+
+	return letstmt
+}
+
+//parseLetBinding parses let x = value, leaving the parser at the end of the value without looking at what follows.
+func (p *Parser) parseLetBinding() ast.Statement {
 	letstmt := &ast.LetStatement{Token: p.currToken}
 	if !p.expectPeek(token.IDENTIFIER) {
-		return nil
+		return &ast.BadStatement{Token: letstmt.Token, End: p.currToken.End}
 	}
 
 	letstmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
 	if !p.expectPeek(token.ASSIGN) {
-		return nil
+		return &ast.BadStatement{Token: letstmt.Token, End: p.currToken.End}
 	}
 	p.NextToken()
 	letstmt.Value = p.parseExpression(LOWEST)
-	for p.peekToken.Type == token.SEMICOLON {
-		p.NextToken()
-	}
-
 	return letstmt
 }
 
@@ -221,19 +386,35 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	retstmt := &ast.ReturnStatement{Token: p.currToken}
 	p.NextToken()
 	retstmt.ReturnValue = p.parseExpression(LOWEST)
-	for p.peekToken.Type == token.SEMICOLON {
+	for p.peekToken.Type == token.SEMICOLON && !p.panicking {
 		p.NextToken()
 	}
 	return retstmt
 }
 
+//break and continue only make sense inside of a loop. A function starts afresh, so a loop around it does not count.
+func (p *Parser) parseLoopControl() ast.Statement {
+	tok := p.currToken
+	if p.loopDepth == 0 {
+		p.errorAt(tok.Span(), diag.OutsideLoop, "%s outside of a loop", tok.Literal)
+		return &ast.BadStatement{Token: tok, End: tok.End}
+	}
+	for p.peekToken.Type == token.SEMICOLON {
+		p.NextToken()
+	}
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 //Parsing expressionns using pratt parser technique.
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
-	if p.peekToken.Type == token.SEMICOLON && p.currToken.Type != token.EOF { //Semicolon is not mandatory
+	if p.peekToken.Type == token.SEMICOLON && p.currToken.Type != token.EOF && !p.panicking { //Semicolon is not mandatory
 		p.NextToken()
 	}
 	return stmt
@@ -273,29 +454,134 @@ func (p *Parser) parseIdentifier() ast.Expression { //For token.IDENT
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	intexp := &ast.IntegerLiteral{Token: p.currToken}
-	val, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
-
+	digits, base, ok := p.integerDigits(intexp.Token)
+	if !ok {
+		return p.badExpression(intexp.Token)
+	}
+	val, err := strconv.ParseInt(digits, base, 64)
 	if err != nil {
-		msg := fmt.Sprintf("Could not parse %q as int64", intexp)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.errorAt(intexp.Span(), diag.LiteralOutOfRange, "integer literal %s is out of range", intexp.Token.Literal).Hint = "integer literals must fit in 64 bits, up to 9223372036854775807"
+		return p.badExpression(intexp.Token)
 	}
 	intexp.Value = val
 	return intexp
 }
 
+//integerDigits checks the digits of an integer literal, and returns them without the base prefix and the _ separators.
+//Like in Go, a _ can only stand between two digits, or between the prefix and the first digit.
+func (p *Parser) integerDigits(tok token.Token) (string, int, bool) {
+	lit := tok.Literal
+	base, kind, start := 10, "decimal", 0
+	if len(lit) > 1 && lit[0] == '0' {
+		switch lit[1] {
+		case 'x', 'X':
+			base, kind, start = 16, "hex", 2
+		case 'o', 'O':
+			base, kind, start = 8, "octal", 2
+		case 'b', 'B':
+			base, kind, start = 2, "binary", 2
+		}
+	}
+	var digits strings.Builder
+	afterDigit := true //the prefix counts as one
+	for i, ch := range lit {
+		if i < start {
+			continue
+		}
+		if ch == '_' {
+			if !afterDigit {
+				p.errorAt(charSpan(tok, i), diag.InvalidLiteral, "'_' must separate successive digits").Hint = "write it like 1_000_000"
+				return "", 0, false
+			}
+			afterDigit = false
+			continue
+		}
+		if _, err := strconv.ParseUint(string(ch), base, 8); err != nil {
+			p.errorAt(charSpan(tok, i), diag.InvalidLiteral, "invalid digit %q in %s literal", ch, kind)
+			return "", 0, false
+		}
+		digits.WriteRune(ch)
+		afterDigit = true
+	}
+	if digits.Len() == 0 {
+		p.errorAt(tok.Span(), diag.InvalidLiteral, "%s literal has no digits", kind)
+		return "", 0, false
+	}
+	if !afterDigit {
+		p.errorAt(charSpan(tok, len(lit)-1), diag.InvalidLiteral, "'_' must separate successive digits").Hint = "write it like 1_000_000"
+		return "", 0, false
+	}
+	return digits.String(), base, true
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	floatexp := &ast.FloatLiteral{Token: p.currToken}
+	lit := floatexp.Token.Literal
+	for i := 0; i < len(lit); i++ {
+		if lit[i] == '_' && (i == 0 || !isDigit(lit[i-1]) || i+1 == len(lit) || !isDigit(lit[i+1])) {
+			p.errorAt(charSpan(floatexp.Token, i), diag.InvalidLiteral, "'_' must separate successive digits").Hint = "write it like 1_000.5"
+			return p.badExpression(floatexp.Token)
+		}
+	}
+	val, err := strconv.ParseFloat(strings.ReplaceAll(lit, "_", ""), 64)
+	if err != nil {
+		p.errorAt(floatexp.Span(), diag.LiteralOutOfRange, "float literal %s is out of range", lit).Hint = "floats are 64 bit, up to about 1.8e308"
+		return p.badExpression(floatexp.Token)
+	}
+	floatexp.Value = val
+	return floatexp
+}
+
+//charSpan is the span of the i-th byte of a token, for pointing at one character of a literal.
+func charSpan(tok token.Token, i int) token.Span {
+	start := tok.Pos
+	start.Offset += i
+	start.Column += i
+	end := start
+	end.Offset++
+	end.Column++
+	return token.Span{Start: start, End: end}
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	stringexp := &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
 	return stringexp
 }
+
+//Enter with currToken at the head of the string, exit at its end.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.currToken, Texts: []string{p.currToken.Literal}}
+	for p.currToken.Type != token.STRING_END {
+		if p.peekToken.Type == token.STRING_MIDDLE || p.peekToken.Type == token.STRING_END {
+			//${} with nothing inside
+			p.errorAt(token.Span{Start: p.currToken.End, End: p.peekToken.Pos}, diag.EmptyInterpolation, "empty interpolation in string").Hint = `put an expression inside ${}, or write \${ for the text itself`
+			str.Values = append(str.Values, &ast.BadExpression{Token: p.peekToken, End: p.peekToken.Pos})
+		} else {
+			p.NextToken()
+			str.Values = append(str.Values, p.parseExpression(LOWEST))
+			if p.peekToken.Type != token.STRING_MIDDLE && p.peekToken.Type != token.STRING_END {
+				p.errorAt(p.peekToken.Span(), diag.UnexpectedToken, "Expected } to close the interpolation. Got %s instead", p.peekToken.Type)
+				return p.badExpression(str.Token)
+			}
+		}
+		p.NextToken()
+		str.Texts = append(str.Texts, p.currToken.Literal)
+	}
+	str.End = p.currToken.End
+	return str
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	boolexp := &ast.Boolean{Token: p.currToken}
 
 	val, err := strconv.ParseBool(p.currToken.Literal)
 	if err != nil {
-		msg := fmt.Sprintf("Could not parse %q as nool", boolexp)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.errorAt(boolexp.Span(), diag.InvalidLiteral, "Could not parse %q as nool", boolexp)
+		return p.badExpression(boolexp.Token)
 	}
 	boolexp.Value = val
 	return boolexp
@@ -313,60 +599,63 @@ func (p *Parser) parseArray() ast.Expression { //Enter with currtoken set as '['
 			if p.peekToken.Type == token.RIGHT_LARGE_BRACKET {
 				p.NextToken()
 				arr.Value = exp
+				arr.End = p.currToken.End
 				return arr
 			}
-			p.errors = append(p.errors, "No comma after element in array.")
+			p.errorAt(p.peekToken.Span(), diag.MissingComma, "No comma after element in array.").Hint = "separate array elements with ','"
 			return arr
 		}
 		p.NextToken()
 		p.NextToken()
 	}
 
-	p.NextToken()
+	arr.End = p.currToken.End
 	arr.Value = exp
-	return arr
+	return arr //Exit with currToken at `]`
 }
 
 func (p *Parser) parseArrObjElement(id ast.Expression) ast.Expression {
 	arrele := &ast.ArrObjElement{Token: p.currToken, Name: id}
 	p.NextToken()
 	arrele.Index = p.parseExpression(LOWEST)
-	if p.peekToken.Type != token.RIGHT_LARGE_BRACKET {
-		return nil
+	if !p.expectPeek(token.RIGHT_LARGE_BRACKET) {
+		arrele.End = arrele.Index.Span().End
+		return arrele
 	}
-	p.NextToken()
+	arrele.End = p.currToken.End
 	return arrele
 }
 func (p *Parser) parseObject() ast.Expression { //Enter with currtoken set as '{'
 	obj := &ast.ObjectLiteral{Token: p.currToken}
-	exp := map[ast.Expression]ast.Expression{}
+	exp := []ast.ObjectPair{}
 	p.NextToken()
 	for p.currToken.Type != token.RIGHT_OBJECT_BRACE && p.currToken.Type != token.EOF {
 		keyExp := p.parseExpression(LOWEST)
 		p.NextToken()
 		if p.currToken.Type != token.KEY_VAL_SEP {
-			p.errors = append(p.errors, "No seperator found between key-values")
+			p.errorAt(p.currToken.Span(), diag.MissingSeparator, "No seperator found between key-values").Hint = "object entries are written as key: value"
 			return obj
 		}
 		p.NextToken()
 		valueExp := p.parseExpression(LOWEST)
-		exp[keyExp] = valueExp
+		exp = append(exp, ast.ObjectPair{Key: keyExp, Value: valueExp})
 		if p.peekToken.Type != token.COMMA {
 			if p.peekToken.Type == token.RIGHT_OBJECT_BRACE {
 				p.NextToken()
-				obj.Value = exp
+				obj.Pairs = exp
+				obj.End = p.currToken.End
 				return obj
 			}
-			p.errors = append(p.errors, "No comma after element in object, found "+p.peekToken.Literal)
+			p.errorAt(p.peekToken.Span(), diag.MissingComma, "No comma after element in object, found %s", p.peekToken.Literal).Hint = "separate object entries with ','"
 			return obj
 		}
 		p.NextToken()
 		p.NextToken()
 	}
 
-	p.NextToken()
-	obj.Value = exp
-	return obj
+	obj.End = p.currToken.End
+	obj.Pairs = exp
+	return obj //Exit with currToken at `}}`
 }
 
 //For parenthesis(grouped expressions)
@@ -376,10 +665,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 	//This will go on recursively parsing the expression untill just before the right parenthesis for this parent expression is encountered.
 	exp := p.parseExpression(LOWEST)
-	if p.peekToken.Type != token.RIGHT_BRACKET {
-		return nil
-	}
-	p.NextToken()
+	p.expectPeek(token.RIGHT_BRACKET)
 	return exp
 
 }
@@ -392,70 +678,242 @@ func (p *Parser) parseBlockStatements() *ast.BlockStatement { //Will enter with
 	p.NextToken()
 
 	for p.currToken.Type != token.RIGHT_BRACE && p.currToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			bs.Stmts = append(bs.Stmts, stmt)
+		stmt, blockEnd := p.parseStatementRecovering()
+		bs.Stmts = append(bs.Stmts, stmt)
+		if blockEnd {
+			break
 		}
 		p.NextToken()
 	}
+	bs.End = p.currToken.End
 	return bs //Exit with currToken either `}` or file ends
 }
 
 //IF_ELSE are expressions in monkey as they produce a value. Hence, if (x>3) 2; is equivalent to if (x>3) return 2;
 func (p *Parser) parseIfExpression() ast.Expression {
 	ife := &ast.IfExpression{Token: p.currToken}
-	if p.peekToken.Type != token.LEFT_BRACKET {
-		return nil
+	if !p.expectPeek(token.LEFT_BRACKET) {
+		return p.badExpression(ife.Token)
 	}
-	p.NextToken()
 
 	ife.Condition = p.parseExpression(LOWEST)
-	if p.peekToken.Type != token.LEFT_BRACE {
-		return nil
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return p.badExpression(ife.Token)
 	}
 
-	p.NextToken()
 	ife.MainStmt = p.parseBlockStatements()
 	//In case there is an else statement
 
 	if p.peekToken.Type == token.ELSE {
 		p.NextToken()
-		if p.peekToken.Type != token.LEFT_BRACE {
-			return nil
+		//else if (...) {...} is the same as else { if (...) {...} }
+		if p.peekToken.Type == token.IF {
+			alt := &ast.BlockStatement{Token: p.currToken}
+			p.NextToken()
+			nested := &ast.ExpressionStatement{Token: p.currToken}
+			nested.Expression = p.parseIfExpression()
+			alt.Stmts = []ast.Statement{nested}
+			alt.End = nested.Span().End
+			ife.AltStmt = alt
+			return ife
+		}
+		if !p.expectPeek(token.LEFT_BRACE) {
+			return p.badExpression(ife.Token)
 		}
-		p.NextToken()
 		ife.AltStmt = p.parseBlockStatements()
 	}
 	return ife
 }
 
-//Parsing For expressions-Looks exactly like If expressions
-func (p *Parser) parseForExpression() ast.Expression {
-	fore := &ast.ForExpression{Token: p.currToken}
-	if p.peekToken.Type != token.LEFT_BRACKET {
-		return nil
+//Parsing match expressions. match (value) { pattern => expr, pattern if guard => { block }, _ => expr }
+//Commas are optional after an arm with a block body.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	me := &ast.MatchExpression{Token: p.currToken}
+	if !p.expectPeek(token.LEFT_BRACKET) {
+		return p.badExpression(me.Token)
 	}
 	p.NextToken()
+	me.Value = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RIGHT_BRACKET) || !p.expectPeek(token.LEFT_BRACE) {
+		return p.badExpression(me.Token)
+	}
+	for p.peekToken.Type != token.RIGHT_BRACE && p.peekToken.Type != token.EOF {
+		p.NextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			p.skipBlock()
+			return p.badExpression(me.Token)
+		}
+		me.Arms = append(me.Arms, arm)
+		if p.peekToken.Type == token.COMMA {
+			p.NextToken()
+			continue
+		}
+		if p.peekToken.Type != token.RIGHT_BRACE && p.currToken.Type != token.RIGHT_BRACE {
+			p.errorAt(p.peekToken.Span(), diag.MissingComma, "No comma after match arm, found %s", p.peekToken.Literal).Hint = "separate match arms with ','"
+			p.skipBlock()
+			return p.badExpression(me.Token)
+		}
+	}
+	if !p.expectPeek(token.RIGHT_BRACE) {
+		return p.badExpression(me.Token)
+	}
+	me.End = p.currToken.End
+	return me
+}
 
-	fore.Condition = p.parseExpression(LOWEST)
-	if p.peekToken.Type != token.LEFT_BRACE {
+//Enters with currToken at the start of the pattern, and leaves at the end of the body.
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+	arm.Pattern = p.parseExpression(LOWEST)
+	if p.peekToken.Type == token.IF {
+		p.NextToken()
+		p.NextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.FAT_ARROW) {
 		return nil
 	}
 	p.NextToken()
+	if p.currToken.Type == token.LEFT_BRACE {
+		arm.Body = p.parseBlockStatements()
+		return arm
+	}
+	//A single expression is kept as a block of one statement, so both kinds of body evaluate the same way.
+	stmt := &ast.ExpressionStatement{Token: p.currToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	arm.Body = &ast.BlockStatement{Token: stmt.Token, Stmts: []ast.Statement{stmt}, End: stmt.Span().End}
+	return arm
+}
+
+//skipBlock skips to the `}` closing the block the parser is in, so that an error inside of it does not leave
+//the rest of the block to be parsed as statements.
+func (p *Parser) skipBlock() {
+	depth := 0
+	for p.peekToken.Type != token.EOF {
+		if p.peekToken.Type == token.RIGHT_BRACE {
+			if depth == 0 {
+				p.NextToken()
+				if p.currToken.Pos == p.panicPos {
+					p.panicPos = token.Position{} //the `}` is ours, it must not end the enclosing block in synchronize
+				}
+				return
+			}
+			depth--
+		}
+		if p.peekToken.Type == token.LEFT_BRACE {
+			depth++
+		}
+		p.NextToken()
+	}
+}
+
+func (p *Parser) parseWildcard() ast.Expression {
+	return &ast.Wildcard{Token: p.currToken}
+}
+
+//Parsing For expressions. There are three forms, told apart by what comes after the `(`:
+//	for (cond) { }                   - the condition alone, looks exactly like If expressions
+//	for (init; cond; update) { }     - C style, any of the parts can be left out
+//	for (x in it) { }, for (k, v in it) { }
+func (p *Parser) parseForExpression() ast.Expression {
+	tok := p.currToken
+	if !p.expectPeek(token.LEFT_BRACKET) {
+		return p.badExpression(tok)
+	}
+	p.NextToken()
+	if p.currToken.Type == token.IDENTIFIER && (p.peekToken.Type == token.IN || p.peekToken.Type == token.COMMA) {
+		return p.parseForInExpression(tok)
+	}
+
+	fore := &ast.ForExpression{Token: tok}
+	switch p.currToken.Type {
+	case token.LET:
+		fore.Init = p.parseLetBinding()
+	case token.SEMICOLON: //no init
+	default:
+		cond := &ast.ExpressionStatement{Token: p.currToken}
+		cond.Expression = p.parseExpression(LOWEST)
+		if p.peekToken.Type != token.SEMICOLON {
+			fore.Condition = cond.Expression
+			if !p.expectPeek(token.RIGHT_BRACKET) {
+				return p.badExpression(tok)
+			}
+			return p.parseLoopBody(fore)
+		}
+		fore.Init = cond
+	}
+	if fore.Init != nil && !p.expectPeek(token.SEMICOLON) {
+		return p.badExpression(tok)
+	}
+	//currToken is the `;` after the init
+	if p.peekToken.Type != token.SEMICOLON {
+		p.NextToken()
+		fore.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return p.badExpression(tok)
+	}
+	if p.peekToken.Type != token.RIGHT_BRACKET {
+		p.NextToken()
+		fore.Update = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RIGHT_BRACKET) {
+		return p.badExpression(tok)
+	}
+	return p.parseLoopBody(fore)
+}
+
+//Enters with currToken at the first variable.
+func (p *Parser) parseForInExpression(tok token.Token) ast.Expression {
+	fie := &ast.ForInExpression{Token: tok}
+	fie.Vars = append(fie.Vars, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+	if p.peekToken.Type == token.COMMA {
+		p.NextToken()
+		if !p.expectPeek(token.IDENTIFIER) {
+			return p.badExpression(tok)
+		}
+		fie.Vars = append(fie.Vars, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+	}
+	if !p.expectPeek(token.IN) {
+		return p.badExpression(tok)
+	}
+	p.NextToken()
+	fie.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RIGHT_BRACKET) || !p.expectPeek(token.LEFT_BRACE) {
+		return p.badExpression(tok)
+	}
+	p.loopDepth++
+	fie.Stmt = p.parseBlockStatements()
+	p.loopDepth--
+	return fie
+}
+
+//Enters with currToken at the `)` before the body.
+func (p *Parser) parseLoopBody(fore *ast.ForExpression) ast.Expression {
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return p.badExpression(fore.Token)
+	}
+	p.loopDepth++
 	fore.Stmt = p.parseBlockStatements()
+	p.loopDepth--
 	return fore
 }
 
 //Parsing functino literals.Function declarations in go are just like expressions. fn(..params){body}
 func (p *Parser) parseFunctionLiterals() ast.Expression {
 	fl := &ast.FunctionLiteral{Token: p.currToken}
-	if p.peekToken.Type != token.LEFT_BRACKET {
-		return nil
+	if !p.expectPeek(token.LEFT_BRACKET) {
+		return p.badExpression(fl.Token)
 	}
-	p.NextToken()
 	fl.Params = p.parseParameters()
-	p.NextToken()
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return p.badExpression(fl.Token)
+	}
+	outerLoops := p.loopDepth
+	p.loopDepth = 0
 	fl.Body = p.parseBlockStatements()
+	p.loopDepth = outerLoops
 	return fl
 }
 
@@ -467,19 +925,20 @@ func (p *Parser) parseParameters() []*ast.Identifier { //Current token will be
 		p.NextToken()
 		return params
 	}
-	p.NextToken()
+	if !p.expectPeek(token.IDENTIFIER) {
+		return params
+	}
 	param := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 	params = append(params, param)
 	for p.peekToken.Type == token.COMMA {
 		p.NextToken() //Will go to next comma
-		p.NextToken() //Will reach to next param
+		if !p.expectPeek(token.IDENTIFIER) {
+			return params
+		}
 		param := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 		params = append(params, param)
 	}
-	if p.peekToken.Type != token.RIGHT_BRACKET {
-		return nil
-	}
-	p.NextToken()
+	p.expectPeek(token.RIGHT_BRACKET)
 	return params //Leave the function with currToken `)`
 }
 
@@ -490,6 +949,7 @@ func (p *Parser) parseParameters() []*ast.Identifier { //Current token will be
 func (p *Parser) parseFunctionCall(function ast.Expression) ast.Expression { //While entering: currtoken would be `(` before the args
 	fc := &ast.FunctionCall{Token: p.currToken, Function: function}
 	fc.Arguments = p.parseArgs()
+	fc.End = p.currToken.End
 	return fc
 }
 
@@ -507,9 +967,6 @@ func (p *Parser) parseArgs() []ast.Expression {
 		p.NextToken()
 		args = append(args, p.parseExpression(LOWEST))
 	}
-	if p.peekToken.Type != token.RIGHT_BRACKET {
-		return nil
-	}
-	p.NextToken() //Leaves at RIGHT BRACKER
+	p.expectPeek(token.RIGHT_BRACKET) //Leaves at RIGHT BRACKER
 	return args
 }
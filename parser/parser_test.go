@@ -2,9 +2,11 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/Revolyssup/monkey/ast"
+	"github.com/Revolyssup/monkey/diag"
 	"github.com/Revolyssup/monkey/lexer"
 )
 
@@ -223,10 +225,15 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
 		{"5 / 5;", 5, "/", 5},
+		{"5 % 5;", 5, "%", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
 		{"true == true;", true, "==", true},
 		{"true != false;", true, "!=", false},
 		{"false == false;", false, "==", false},
@@ -366,6 +373,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b / c",
 			"(a + (b / c))",
 		},
+		{
+			"a - b % c * d",
+			"(a - ((b % c) * d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a > 0 && a <= 10 == true",
+			"((a > 0) && ((a <= 10) == true))",
+		},
+		{
+			"!a || b >= c + 1",
+			"((!a) || (b >= (c + 1)))",
+		},
 		{
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
@@ -414,6 +441,54 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"[1,][0] + [][0]",
+			"([1][0] + [][0])",
+		},
+		{
+			"a[i + 1] * f(x)[0]",
+			"(a[(i + 1)] * f(x)[0])",
+		},
+		{
+			"a = b = 1 + 2",
+			"(a = (b = (1 + 2)))",
+		},
+		{
+			"x += y * 2 || z",
+			"(x += ((y * 2) || z))",
+		},
+		{
+			"x++ + -y--",
+			"((x++) + (-(y--)))",
+		},
+		{
+			"f(x++, y -= 1)",
+			"f((x++), (y -= 1))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"a || b | c && d",
+			"(a || ((b | c) && d))",
+		},
+		{
+			"a << 1 + 2 < b >> c",
+			"((a << (1 + 2)) < (b >> c))",
+		},
+		{
+			"~a & -b",
+			"((~a) & (-b))",
+		},
+		{
+			"a & b & c",
+			"((a & b) & c)",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -462,6 +537,57 @@ func TestIfExpression(t *testing.T) {
 		t.Errorf("exp.Alternative.Statements was  nil. got=%+v", exp.AltStmt)
 	}
 }
+func TestElseIfExpression(t *testing.T) {
+	input := `if (a) { 1 } else if (b) { 2 } else { 3 }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if len(exp.AltStmt.Stmts) != 1 {
+		t.Fatalf("alternative is not 1 statement. got=%d", len(exp.AltStmt.Stmts))
+	}
+	nested, ok := exp.AltStmt.Stmts[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not an ast.IfExpression. got=%T", exp.AltStmt.Stmts[0])
+	}
+	if !testIdentifier(t, nested.Condition, "b") {
+		return
+	}
+	if nested.AltStmt == nil {
+		t.Fatalf("nested if has no else")
+	}
+	if exp.Span().End != nested.Span().End {
+		t.Errorf("chain does not end with its last branch. got=%s, want=%s", exp.Span().End, nested.Span().End)
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { 1 => a, _ => b }", "match (x) {1 => a, _ => b}"},
+		{"match (x) { 1 => a, _ => b, }", "match (x) {1 => a, _ => b}"},
+		{"match (x) { n if n > 1 => { n } [a, _] => a }", "match (x) {n if (n > 1) => n, [a,_] => a}"},
+		{`match (f(x)) { {{"k": v}} => v + 1 }`, "match (f(x)) {{k:v,\n} => (v + 1)}"},
+		{"match (x) {}", "match (x) {}"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement. got=%d", tt.input, len(program.Statements))
+		}
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
 func TestForExpression(t *testing.T) {
 	input := `for (x < y) { x }`
 	l := lexer.New(input)
@@ -486,6 +612,50 @@ func TestForExpression(t *testing.T) {
 	}
 
 }
+func TestForLoopForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x < y) { x }", "for (x < y) x"},
+		{"for (let i = 0; i < 10; i++) { i }", "for (let i = 0; (i < 10); (i++)) i"},
+		{"for (i = 0; i < 10; i += 2) { i }", "for ((i = 0); (i < 10); (i += 2)) i"},
+		{"for (;;) { break }", "for  break;"},
+		{"for (let i = 0;;) { break }", "for (let i = 0; ; ) break;"},
+		{"for (; i < 3; i++) { i }", "for (; (i < 3); (i++)) i"},
+		{"for (x in [1, 2]) { x }", "for (x in [1,2]) x"},
+		{"for (k, v in f(obj)) { k }", "for (k, v in f(obj)) k"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement. got=%d", tt.input, len(program.Statements))
+		}
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	errors := []string{
+		"for (let i = 0; i < 3) { i }",
+		"for (a, in b) { a }",
+		"for (a, b, c in d) { a }",
+		"for (x in y { x }",
+		"for (in y) { x }",
+	}
+	for _, input := range errors {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected a parser error", input)
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 	l := lexer.New(input)
@@ -538,6 +708,43 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		texts    []string
+		expected string
+	}{
+		{`"Hello ${user["name"]}, you have ${count + 1} items"`, []string{"Hello ", ", you have ", " items"}, "Hello ${user[name]}, you have ${(count + 1)} items"},
+		{`"${a}${b}"`, []string{"", "", ""}, "${a}${b}"},
+		{`"x ${ "y ${z}" }"`, []string{"x ", ""}, "x ${y ${z}}"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+		if len(str.Texts) != len(tt.texts) || len(str.Values) != len(tt.texts)-1 {
+			t.Fatalf("%q: wrong number of parts. got %d texts and %d values", tt.input, len(str.Texts), len(str.Values))
+		}
+		for i, text := range tt.texts {
+			if str.Texts[i] != text {
+				t.Errorf("%q: text %d is not %q. got=%q", tt.input, i, text, str.Texts[i])
+			}
+		}
+		if str.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, str.String())
+		}
+		if str.Span().End.Offset != len(tt.input) {
+			t.Errorf("%q: span should end at the closing quote, ends at %d", tt.input, str.Span().End.Offset)
+		}
+	}
+}
+
 func TestArray(t *testing.T) {
 	input := `[5,1,12]`
 	l := lexer.New(input)
@@ -554,24 +761,35 @@ func TestArray(t *testing.T) {
 	}
 }
 
-// func TestObject(t *testing.T) {
-// 	input := `{
-// 		"name:"Ashish",
-// 		"roll":2
-// 	}`
-// 	l := lexer.New(input)
-// 	p := New(l)
-// 	program := p.ParseProgram()
-// 	checkParserErrors(t, p)
-// 	stmt := program.Statements[0].(*ast.ExpressionStatement)
-// 	literal, ok := stmt.Expression.(*ast.ObjectLiteral)
-// 	if !ok {
-// 		t.Fatalf("exp not *ast.ArrayLiteral. got=%T", stmt.Expression)
-// 	}
-// 	if literal.String() != `[5,1,12,]` {
-// 		t.Errorf("literal.String() not %q. got=%q", `[5,1,12,]`, literal.String())
-// 	}
-// }
+func TestObject(t *testing.T) {
+	input := `{{
+		"name": "Ashish",
+		"roll": 2,
+		1 + 1: fn(x) { x },
+	}}`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.ObjectLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.ObjectLiteral. got=%T", stmt.Expression)
+	}
+	expected := "{name:Ashish,\nroll:2,\n(1 + 1):fn(x)x,\n}"
+	for i := 0; i < 10; i++ { //map ordering would show up as a different string on some run
+		if literal.String() != expected {
+			t.Fatalf("literal.String() not %q. got=%q", expected, literal.String())
+		}
+	}
+	if len(literal.Pairs) != 3 {
+		t.Fatalf("wrong number of pairs. got=%d", len(literal.Pairs))
+	}
+	if key := literal.Pairs[0].Key.String(); key != "name" {
+		t.Errorf("first key is not name. got=%q", key)
+	}
+}
+
 func TestArrayEle(t *testing.T) {
 	input := `a[0]`
 	l := lexer.New(input)
@@ -587,3 +805,349 @@ func TestArrayEle(t *testing.T) {
 		t.Errorf("literal.String() not %q. got=%q", `a[0]`, literal.String())
 	}
 }
+
+func TestNodeSpans(t *testing.T) {
+	input := `let add = fn(x, y) {
+	x + y;
+};
+add(1, [2, 3][0])`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, input},
+		{program.Statements[0], input[:strings.Index(input, ";\nadd")]},
+		{program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body, "{\n\tx + y;\n}"},
+		{program.Statements[1], "add(1, [2, 3][0])"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionCall).Arguments[1], "[2, 3][0]"},
+	}
+	for i, tt := range tests {
+		span := tt.node.Span()
+		got := input[span.Start.Offset:span.End.Offset]
+		if got != tt.expected {
+			t.Errorf("test[%d]: wrong span. expected=%q, got=%q", i, tt.expected, got)
+		}
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	input := `let x = 1;
+let y = [1 2];`
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	d := errors[0]
+	if d.Code != diag.MissingComma {
+		t.Errorf("wrong code. expected=%s, got=%s", diag.MissingComma, d.Code)
+	}
+	if d.Severity != diag.Error {
+		t.Errorf("wrong severity. got=%s", d.Severity)
+	}
+	if d.Span.Start.Line != 2 || d.Span.Start.Column != 12 {
+		t.Errorf("wrong position. expected 2:12, got=%s", d.Span.Start)
+	}
+	if d.Hint == "" {
+		t.Errorf("expected a hint for a missing comma")
+	}
+}
+
+func TestIndexAssignmentParsing(t *testing.T) {
+	l := lexer.New(`a[1]["k"] = x + 1`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	assign, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("expression is not *ast.AssignExpression. got=%T", stmt.Expression)
+	}
+	outer, ok := assign.Target.(*ast.ArrObjElement)
+	if !ok {
+		t.Fatalf("target is not *ast.ArrObjElement. got=%T", assign.Target)
+	}
+	if _, ok := outer.Name.(*ast.ArrObjElement); !ok {
+		t.Errorf("nested target is not *ast.ArrObjElement. got=%T", outer.Name)
+	}
+	if assign.Value.String() != "(x + 1)" {
+		t.Errorf("wrong value. got=%q", assign.Value.String())
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	tests := []struct {
+		input  string
+		column int
+	}{
+		{"5 = x", 1},
+		{"let y = f(1) *= 2;", 9},
+		{"x + 1++", 5},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got=%d (%v)", tt.input, len(errors), errors)
+		}
+		if errors[0].Code != diag.InvalidTarget {
+			t.Errorf("%q: wrong code. expected=%s, got=%s", tt.input, diag.InvalidTarget, errors[0].Code)
+		}
+		if errors[0].Span.Start.Column != tt.column {
+			t.Errorf("%q: wrong column. expected=%d, got=%d", tt.input, tt.column, errors[0].Span.Start.Column)
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors int
+	}{
+		{"for (true) { break; continue }", 0},
+		{"for (true) { if (x) { break } else { continue } }", 0},
+		{"for (a) { for (b) { break } break }", 0},
+		{"break", 1},
+		{"if (x) { continue }", 1},
+		{"for (true) { let f = fn() { break } }", 1},
+		{"let f = fn() { for (true) { break } }; continue; break", 2},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != tt.errors {
+			t.Errorf("%q: expected %d errors, got=%d (%v)", tt.input, tt.errors, len(p.Errors()), p.Errors())
+			continue
+		}
+		for _, err := range p.Errors() {
+			if err.Code != diag.OutsideLoop {
+				t.Errorf("%q: wrong code. expected=%s, got=%s", tt.input, diag.OutsideLoop, err.Code)
+			}
+		}
+		_ = program.String()
+	}
+}
+
+func TestLexerDiagnosticsAreReported(t *testing.T) {
+	input := `let a = "ok\q";
+let b = 1 +;
+let c = "never closed`
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+	expected := []string{diag.InvalidEscape, diag.NoPrefixParse, diag.UnterminatedString}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got=%d (%v)", len(expected), len(errors), errors)
+	}
+	for i, code := range expected {
+		if errors[i].Code != code {
+			t.Errorf("error %d: expected code %s, got=%s", i, code, errors[i].Code)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     int
+		statements int
+	}{
+		{"let = 5; let y = 10; y", 1, 3},
+		{"let x 5; let y = 10;", 1, 2},
+		{"if (x { 1 }; let a = 2;", 1, 2},
+		{"fn(a, b { a }; let c = 3;", 1, 2},
+		{"fn(a, 1) { a }; let c = 3;", 1, 2},
+		{"foo(1, 2; let x = 1;", 1, 2},
+		{"(1 + 2; 3", 1, 2},
+		{"a[1; let b = 2;", 1, 2},
+		{"let = 1; let y = ; let z = 3;", 2, 3},
+		{"let f = fn() { let = 1; 2 }; f", 1, 2},
+		{"let f = fn() { 1 + }; f", 1, 2},
+		{"} let a = 1;", 1, 2},
+		{"1 = 2; let a = 1;", 1, 2},
+		{"f() += 1; x++", 1, 2},
+		{"match (x) { 1 => 2 3 => 4 }; let a = 1;", 1, 2},
+		{"match (x) { 1 2 }; let a = 1;", 1, 2},
+		{"let f = fn() { match (x) { 1 } 5 }; f", 1, 2},
+		{`let s = "a ${} b"; let c = 1;`, 1, 2},
+		{`let s = "a ${x y} b"; let c = 1;`, 1, 2},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != tt.errors {
+			t.Errorf("%q: expected %d errors, got=%d (%v)", tt.input, tt.errors, len(p.Errors()), p.Errors())
+		}
+		if len(program.Statements) != tt.statements {
+			t.Errorf("%q: expected %d statements, got=%d (%s)", tt.input, tt.statements, len(program.Statements), program.String())
+		}
+		for i, stmt := range program.Statements {
+			if stmt == nil {
+				t.Errorf("%q: statement %d is nil", tt.input, i)
+			}
+		}
+		_ = program.String() //must not run into any nil node
+	}
+}
+
+func TestErrorRecoveryPlaceholders(t *testing.T) {
+	input := `let = 5;
+let f = fn() { let x = ; x };
+let y = 10;`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 2 {
+		t.Fatalf("expected 2 errors, got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got=%d", len(program.Statements))
+	}
+	if _, ok := program.Statements[0].(*ast.BadStatement); !ok {
+		t.Errorf("statement 0 is not *ast.BadStatement. got=%T", program.Statements[0])
+	}
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if len(fn.Body.Stmts) != 2 {
+		t.Fatalf("function body does not have 2 statements. got=%d", len(fn.Body.Stmts))
+	}
+	inner, ok := fn.Body.Stmts[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("body statement 0 is not *ast.LetStatement. got=%T", fn.Body.Stmts[0])
+	}
+	if _, ok := inner.Value.(*ast.BadExpression); !ok {
+		t.Errorf("let value is not *ast.BadExpression. got=%T", inner.Value)
+	}
+	testLetStatement(t, program.Statements[2], "y")
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	input := `3.25;`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %v. got=%v", 3.25, literal.Value)
+	}
+}
+
+func TestNumberLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0xFF", int64(255)},
+		{"0Xff", int64(255)},
+		{"0o755", int64(493)},
+		{"0b1010", int64(10)},
+		{"1_000_000", int64(1000000)},
+		{"0x_FF_FF", int64(65535)},
+		{"007", int64(7)},
+		{"9223372036854775807", int64(9223372036854775807)},
+		{"1.5e-3", 0.0015},
+		{"2E+3", 2000.0},
+		{"1e3", 1000.0},
+		{"1_000.000_5", 1000.0005},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		switch expected := tt.expected.(type) {
+		case int64:
+			literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+			if !ok {
+				t.Fatalf("%q: exp not *ast.IntegerLiteral. got=%T", tt.input, stmt.Expression)
+			}
+			if literal.Value != expected {
+				t.Errorf("%q: literal.Value not %d. got=%d", tt.input, expected, literal.Value)
+			}
+		case float64:
+			literal, ok := stmt.Expression.(*ast.FloatLiteral)
+			if !ok {
+				t.Fatalf("%q: exp not *ast.FloatLiteral. got=%T", tt.input, stmt.Expression)
+			}
+			if literal.Value != expected {
+				t.Errorf("%q: literal.Value not %v. got=%v", tt.input, expected, literal.Value)
+			}
+		}
+	}
+}
+
+func TestNumberLiteralDiagnostics(t *testing.T) {
+	tests := []struct {
+		input   string
+		code    string
+		message string
+		column  int
+	}{
+		{"let a = 0b102;", diag.InvalidLiteral, "invalid digit '2' in binary literal", 13},
+		{"let a = 0o78;", diag.InvalidLiteral, "invalid digit '8' in octal literal", 12},
+		{"let a = 0xFG;", diag.InvalidLiteral, "invalid digit 'G' in hex literal", 12},
+		{"let a = 0x;", diag.InvalidLiteral, "hex literal has no digits", 9},
+		{"let a = 1__000;", diag.InvalidLiteral, "'_' must separate successive digits", 11},
+		{"let a = 1000_;", diag.InvalidLiteral, "'_' must separate successive digits", 13},
+		{"let a = 0b_;", diag.InvalidLiteral, "binary literal has no digits", 9},
+		{"let a = 1_.5;", diag.InvalidLiteral, "'_' must separate successive digits", 10},
+		{"let a = 1.5_e3;", diag.InvalidLiteral, "'_' must separate successive digits", 12},
+		{"let a = 9223372036854775808;", diag.LiteralOutOfRange, "integer literal 9223372036854775808 is out of range", 9},
+		{"let a = 0x1_0000_0000_0000_0000;", diag.LiteralOutOfRange, "integer literal 0x1_0000_0000_0000_0000 is out of range", 9},
+		{"let a = 1e400;", diag.LiteralOutOfRange, "float literal 1e400 is out of range", 9},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got=%d (%v)", tt.input, len(errors), errors)
+		}
+		d := errors[0]
+		if d.Code != tt.code || d.Message != tt.message {
+			t.Errorf("%q: wrong error. expected=%s %q, got=%s %q", tt.input, tt.code, tt.message, d.Code, d.Message)
+		}
+		if d.Span.Start.Line != 1 || d.Span.Start.Column != tt.column {
+			t.Errorf("%q: wrong position. expected=1:%d, got=%s", tt.input, tt.column, d.Span.Start)
+		}
+	}
+}
+
+func TestBlocksClosingTogether(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (1) { 1 => { 2 }}", "match (1) {1 => 2}"},
+		{"for (x in [1]) { if (true) { print(x) }}", "for (x in [1]) iftrue print(x)"},
+		{"let f = fn() { if (a) { 1 } else { 2 }};", "let f = fn()ifa 1 else 2;"},
+		{`let o = {{"f": fn() { 1 }}};`, "let o = {f:fn()1,\n};"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
@@ -8,19 +8,21 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/Revolyssup/monkey/diag"
 	"github.com/Revolyssup/monkey/eval"
 	"github.com/Revolyssup/monkey/lexer"
 	"github.com/Revolyssup/monkey/obj"
 	"github.com/Revolyssup/monkey/parser"
 )
 
-func PrintParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+//PrintParserErrors renders each diagnostic against the source it was found in.
+func PrintParserErrors(out io.Writer, source string, errors []diag.Diagnostic) {
+	for _, d := range errors {
+		diag.Render(out, source, d)
 	}
 }
 func CloseHandler() {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
@@ -47,7 +49,7 @@ func StartRepl(in io.Reader, out io.Writer) {
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			PrintParserErrors(out, p.Errors())
+			PrintParserErrors(out, input, p.Errors())
 			continue
 		}
 
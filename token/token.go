@@ -1,21 +1,71 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
+//Position is a location in the source. Line and Column start at 1, Column counts characters, Offset is the byte offset into the input.
+type Position struct {
+	File   string
+	Offset int
+	Line   int
+	Column int
+}
+
+//A position with no line is one that was never set, e.g. for nodes built by hand.
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+func (pos Position) String() string {
+	s := pos.File
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+//Span covers the source from Start up to, but not including, End.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position //where the token starts
+	End     Position //just past the last character of the token
+}
+
+func (t Token) Span() Span {
+	return Span{Start: t.Pos, End: t.End}
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"for":    FOR,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"for":      FOR,
+	"return":   RETURN,
+	"match":    MATCH,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"in":       IN,
+	"_":        WILDCARD, //a lone _, names like _x are identifiers
 }
 
 const (
@@ -28,17 +78,38 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	FOR      = "FOR"
+	MATCH    = "MATCH"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IN       = "IN"
 	//Operators
-	PLUS      = "+"
-	MINUS     = "-"
-	SLASH     = "/"
-	ASTERIK   = "*"
-	LESS_THAN = "<"
-	GRTR_THAN = ">"
-	BANG      = "!"
-	ASSIGN    = "="
-	EQUAL     = "=="
-	NOT_EQUAL = "!="
+	PLUS       = "+"
+	MINUS      = "-"
+	SLASH      = "/"
+	ASTERIK    = "*"
+	MODULO     = "%"
+	LESS_THAN  = "<"
+	GRTR_THAN  = ">"
+	LESS_EQUAL = "<="
+	GRTR_EQUAL = ">="
+	AND        = "&&"
+	OR         = "||"
+	BANG       = "!"
+	ASSIGN     = "="
+	EQUAL      = "=="
+	NOT_EQUAL  = "!="
+	//bitwise
+	BIT_AND     = "&"
+	BIT_OR      = "|"
+	BIT_XOR     = "^"
+	BIT_NOT     = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+	//compound assignments
+	PLUS_ASSIGN    = "+="
+	MINUS_ASSIGN   = "-="
+	ASTERIK_ASSIGN = "*="
+	SLASH_ASSIGN   = "/="
 	//delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -52,6 +123,8 @@ const (
 	LEFT_LARGE_BRACKET  = "["
 	RIGHT_LARGE_BRACKET = "]"
 	KEY_VAL_SEP         = ":"
+	FAT_ARROW           = "=>"
+	WILDCARD            = "_"
 	INCREMENT           = "++"
 	DECREMENT           = "--"
 	//identifier
@@ -59,7 +132,12 @@ const (
 
 	//literal
 	INTEGER = "INT"
+	FLOAT   = "FLOAT"
 	STRING  = "STRING"
+	//"text ${ ... } text ${ ... } text" comes as a head, middles and an end, with the tokens of each expression in between.
+	STRING_HEAD   = "STRING_HEAD"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_END    = "STRING_END"
 	//special
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"